@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dschanoeh/hover-ddns/dnsprovider"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+const (
+	acmeChallengeLabel      = "_acme-challenge"
+	acmeChallengeTTL        = 300
+	acmePropagationTimeout  = 10 * time.Minute
+	acmePropagationInterval = 15 * time.Second
+)
+
+// runACMEHook implements certbot's --manual-auth-hook and --manual-cleanup-hook for DNS-01 challenges.
+// The domain and validation token are read from CERTBOT_DOMAIN and CERTBOT_VALIDATION.
+func runACMEHook(logger *zap.Logger, config *Config, cleanup bool) error {
+	domain := strings.ToLower(strings.TrimSuffix(os.Getenv("CERTBOT_DOMAIN"), "."))
+	validation := os.Getenv("CERTBOT_VALIDATION")
+	if domain == "" || validation == "" {
+		return errors.New("CERTBOT_DOMAIN and CERTBOT_VALIDATION must be set")
+	}
+
+	zone, err := findZone(logger, config, domain)
+	if err != nil {
+		return err
+	}
+	backend, _, err := commandProvider(logger, config, zone)
+	if err != nil {
+		return err
+	}
+	name := acmeChallengeName(domain, zone)
+
+	if cleanup {
+		return backend.DeleteRecord(zone, name, "TXT", validation)
+	}
+
+	err = backend.AddRecord(zone, name, "TXT", validation, acmeChallengeTTL)
+	if err != nil {
+		return err
+	}
+
+	return waitForRecord(context.Background(), logger, zone, recordFQDN(name, zone), dns.TypeTXT, validation, config.DNSServer,
+		acmePropagationTimeout, acmePropagationInterval)
+}
+
+// findZone returns the domain that domain belongs to, preferring the longest match. Configured domains
+// are searched first, then the domains of the Hover account.
+func findZone(logger *zap.Logger, config *Config, domain string) (string, error) {
+	domains := []string{}
+	for _, domainConfig := range config.Domains {
+		domains = append(domains, domainConfig.DomainName)
+	}
+	zone := longestZoneMatch(domain, domains)
+	if zone != "" {
+		return zone, nil
+	}
+
+	defaultDomain := &DomainConfig{}
+	if err := validateProviderConfig(config, defaultDomain); err != nil {
+		return "", errors.New("'" + domain + "' doesn't belong to any configured domain")
+	}
+	backend, err := newDNSProvider(logger, config, defaultDomain)
+	if err != nil {
+		return "", err
+	}
+	if err = backend.Authenticate(); err != nil {
+		return "", err
+	}
+	domains, err = backend.(dnsprovider.DomainLister).Domains()
+	if err != nil {
+		return "", err
+	}
+
+	zone = longestZoneMatch(domain, domains)
+	if zone == "" {
+		return "", errors.New("could not find a domain for '" + domain + "' in the configuration or the Hover account")
+	}
+	return zone, nil
+}
+
+func longestZoneMatch(domain string, domains []string) string {
+	zone := ""
+	for _, d := range domains {
+		name := strings.ToLower(strings.TrimSuffix(d, "."))
+		if (domain == name || strings.HasSuffix(domain, "."+name)) && len(name) > len(zone) {
+			zone = name
+		}
+	}
+	return zone
+}
+
+// acmeChallengeName returns the name of the challenge record relative to zone
+func acmeChallengeName(domain string, zone string) string {
+	if domain == zone {
+		return acmeChallengeLabel
+	}
+	return acmeChallengeLabel + "." + strings.TrimSuffix(domain, "."+zone)
+}
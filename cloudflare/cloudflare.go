@@ -0,0 +1,472 @@
+package cloudflare
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dschanoeh/hover-ddns/dnsprovider"
+	"go.uber.org/zap"
+)
+
+const (
+	APIURL   = "https://api.cloudflare.com/client/v4"
+	pageSize = 100
+)
+
+// Client manages records through the Cloudflare API v4 using an API token
+type Client struct {
+	logger     *zap.SugaredLogger
+	httpClient *http.Client
+	apiURL     string
+	token      string
+	// proxied is applied to created and updated records. If nil, updated records keep their setting.
+	proxied *bool
+	zoneIDs map[string]string
+}
+
+type envelope struct {
+	Success    bool            `json:"success"`
+	Errors     []apiError      `json:"errors"`
+	Result     json.RawMessage `json:"result"`
+	ResultInfo struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type zone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Record struct {
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Content  string `json:"content"`
+	Priority *int   `json:"priority,omitempty"`
+	TTL      int    `json:"ttl"`
+	Proxied  *bool  `json:"proxied,omitempty"`
+}
+
+func NewClient(logger *zap.Logger, token string, proxied *bool) *Client {
+	return &Client{
+		logger:     logger.Sugar(),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		apiURL:     APIURL,
+		token:      token,
+		proxied:    proxied,
+		zoneIDs:    map[string]string{},
+	}
+}
+
+// WithLogger returns a client that logs to logger and shares the zone ID cache of this one
+func (c *Client) WithLogger(logger *zap.Logger) dnsprovider.Provider {
+	client := *c
+	client.logger = logger.Sugar()
+	return &client
+}
+
+// Authenticate checks that the token grants access to at least one zone. Listing zones works with user
+// and account owned tokens alike, unlike /user/tokens/verify which only knows user tokens.
+func (c *Client) Authenticate() error {
+	zones := []zone{}
+	err := c.request(http.MethodGet, "/zones?per_page=1", nil, &zones)
+	if err != nil {
+		return err
+	}
+	if len(zones) == 0 {
+		return errors.New("API token doesn't grant access to any zone")
+	}
+	return nil
+}
+
+// Records returns all records of the given domain
+func (c *Client) Records(domain string) ([]dnsprovider.Record, error) {
+	zoneID, err := c.zoneID(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := c.listRecords(zoneID, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := []dnsprovider.Record{}
+	for _, record := range records {
+		result = append(result, dnsprovider.Record{
+			ID:      record.ID,
+			Name:    relativeName(record.Name, domain),
+			Type:    record.Type,
+			Content: recordContent(record),
+			TTL:     record.TTL,
+		})
+	}
+	return result, nil
+}
+
+// UpsertRecord patches the first existing record of the given name and type in place and deletes any
+// further ones. A new record is created if there is none.
+func (c *Client) UpsertRecord(domain string, name string, recordType string, content string, ttl int) error {
+	zoneID, err := c.zoneID(domain)
+	if err != nil {
+		return err
+	}
+
+	existing, err := c.findRecords(zoneID, domain, name, recordType)
+	if err != nil {
+		return err
+	}
+
+	record, err := newRecord(recordType, content, ttl)
+	if err != nil {
+		return err
+	}
+	if proxiable(recordType) {
+		record.Proxied = c.proxied
+	}
+	if len(existing) == 0 {
+		record.Type = recordType
+		record.Name = absoluteName(name, domain)
+		c.logger.Infof("Creating new record of type '%s' and content '%s'...", recordType, content)
+		return c.request(http.MethodPost, "/zones/"+zoneID+"/dns_records", record, nil)
+	}
+
+	c.logger.Infof("Updating record %s of type '%s' to content '%s'...", existing[0].ID, recordType, content)
+	err = c.request(http.MethodPatch, "/zones/"+zoneID+"/dns_records/"+existing[0].ID, record, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range existing[1:] {
+		err = c.deleteRecord(zoneID, r.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddRecord creates a record without touching existing records of the same name and type
+func (c *Client) AddRecord(domain string, name string, recordType string, content string, ttl int) error {
+	zoneID, err := c.zoneID(domain)
+	if err != nil {
+		return err
+	}
+
+	record, err := newRecord(recordType, content, ttl)
+	if err != nil {
+		return err
+	}
+	record.Type = recordType
+	record.Name = absoluteName(name, domain)
+	if proxiable(recordType) {
+		record.Proxied = c.proxied
+	}
+	c.logger.Infof("Creating new record of type '%s' and content '%s'...", recordType, content)
+	return c.request(http.MethodPost, "/zones/"+zoneID+"/dns_records", record, nil)
+}
+
+// UpdateRecord patches the record of the given name and type that has oldContent in place
+func (c *Client) UpdateRecord(domain string, name string, recordType string, oldContent string, content string, ttl int) error {
+	zoneID, err := c.zoneID(domain)
+	if err != nil {
+		return err
+	}
+
+	existing, err := c.findRecords(zoneID, domain, name, recordType)
+	if err != nil {
+		return err
+	}
+	for _, r := range existing {
+		if strings.Trim(recordContent(r), `"`) != strings.Trim(oldContent, `"`) {
+			continue
+		}
+
+		record, err := newRecord(recordType, content, ttl)
+		if err != nil {
+			return err
+		}
+		if proxiable(recordType) {
+			record.Proxied = c.proxied
+		}
+		c.logger.Infof("Updating record %s of type '%s' to content '%s'...", r.ID, recordType, content)
+		return c.request(http.MethodPatch, "/zones/"+zoneID+"/dns_records/"+r.ID, record, nil)
+	}
+	return errors.New("no " + recordType + " record of '" + absoluteName(name, domain) + "' with content '" + oldContent + "'")
+}
+
+// DeleteRecords deletes all records of the given name and type
+func (c *Client) DeleteRecords(domain string, name string, recordType string) error {
+	zoneID, err := c.zoneID(domain)
+	if err != nil {
+		return err
+	}
+
+	existing, err := c.findRecords(zoneID, domain, name, recordType)
+	if err != nil {
+		return err
+	}
+	for _, r := range existing {
+		err = c.deleteRecord(zoneID, r.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteRecord deletes the records of the given name and type that have the given content
+func (c *Client) DeleteRecord(domain string, name string, recordType string, content string) error {
+	zoneID, err := c.zoneID(domain)
+	if err != nil {
+		return err
+	}
+
+	existing, err := c.findRecords(zoneID, domain, name, recordType)
+	if err != nil {
+		return err
+	}
+	for _, r := range existing {
+		if strings.Trim(recordContent(r), `"`) != strings.Trim(content, `"`) {
+			continue
+		}
+		err = c.deleteRecord(zoneID, r.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Domains returns the names of all zones the token has access to
+func (c *Client) Domains() ([]string, error) {
+	names := []string{}
+	for page := 1; ; page++ {
+		query := url.Values{"page": {strconv.Itoa(page)}, "per_page": {strconv.Itoa(pageSize)}}
+		var zones []zone
+		response, err := c.requestPage(http.MethodGet, "/zones?"+query.Encode(), nil, &zones)
+		if err != nil {
+			return nil, err
+		}
+		for _, z := range zones {
+			names = append(names, z.Name)
+		}
+
+		if page >= response.ResultInfo.TotalPages {
+			return names, nil
+		}
+	}
+}
+
+func (c *Client) zoneID(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if id, ok := c.zoneIDs[domain]; ok {
+		return id, nil
+	}
+
+	var zones []zone
+	err := c.request(http.MethodGet, "/zones?"+url.Values{"name": {domain}}.Encode(), nil, &zones)
+	if err != nil {
+		return "", err
+	}
+	if len(zones) == 0 {
+		return "", errors.New("zone '" + domain + "' not found")
+	}
+
+	c.logger.Infof("Found zone ID %s for domain %s", zones[0].ID, domain)
+	c.zoneIDs[domain] = zones[0].ID
+	return zones[0].ID, nil
+}
+
+// LookupRecords reads the records of the given name and type from the API, as proxied records resolve to
+// addresses of Cloudflare. The records are proxied after an update if configured so, otherwise they keep
+// their setting.
+func (c *Client) LookupRecords(domain string, name string, recordType string) ([]string, bool, error) {
+	zoneID, err := c.zoneID(domain)
+	if err != nil {
+		return nil, false, err
+	}
+
+	existing, err := c.findRecords(zoneID, domain, name, recordType)
+	if err != nil {
+		return nil, false, err
+	}
+
+	contents := []string{}
+	proxied := false
+	for _, r := range existing {
+		contents = append(contents, recordContent(r))
+		if r.Proxied != nil && *r.Proxied {
+			proxied = true
+		}
+	}
+	if c.proxied != nil {
+		proxied = *c.proxied
+	}
+	return contents, proxied, nil
+}
+
+// newRecord builds the body to create or update a record. The API expects the priority of MX records
+// separately from the content.
+func newRecord(recordType string, content string, ttl int) (Record, error) {
+	record := Record{Content: content, TTL: ttl}
+	if strings.EqualFold(recordType, "MX") {
+		fields := strings.Fields(content)
+		if len(fields) != 2 {
+			return Record{}, errors.New("'" + content + "' is not a valid MX record")
+		}
+		priority, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return Record{}, errors.New("'" + fields[0] + "' is not a valid MX priority")
+		}
+		record.Content = fields[1]
+		record.Priority = &priority
+	}
+	return record, nil
+}
+
+// recordContent returns the content of record in presentation format, prepending the MX priority
+func recordContent(record Record) string {
+	if record.Type == "MX" && record.Priority != nil {
+		return strconv.Itoa(*record.Priority) + " " + record.Content
+	}
+	return record.Content
+}
+
+// proxiable reports whether Cloudflare can proxy records of the given type
+func proxiable(recordType string) bool {
+	switch strings.ToUpper(recordType) {
+	case "A", "AAAA", "CNAME":
+		return true
+	}
+	return false
+}
+
+func (c *Client) findRecords(zoneID string, domain string, name string, recordType string) ([]Record, error) {
+	query := url.Values{
+		"type": {recordType},
+		"name": {absoluteName(name, domain)},
+	}
+	return c.listRecords(zoneID, query)
+}
+
+// listRecords returns the records of a zone matching query, following the pagination
+func (c *Client) listRecords(zoneID string, query url.Values) ([]Record, error) {
+	records := []Record{}
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		query.Set("per_page", strconv.Itoa(pageSize))
+
+		var result []Record
+		response, err := c.requestPage(http.MethodGet, "/zones/"+zoneID+"/dns_records?"+query.Encode(), nil, &result)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, result...)
+
+		if page >= response.ResultInfo.TotalPages {
+			return records, nil
+		}
+	}
+}
+
+func (c *Client) deleteRecord(zoneID string, recordID string) error {
+	c.logger.Infof("Deleting record %s...", recordID)
+	return c.request(http.MethodDelete, "/zones/"+zoneID+"/dns_records/"+recordID, nil, nil)
+}
+
+func (c *Client) request(method string, path string, body interface{}, result interface{}) error {
+	_, err := c.requestPage(method, path, body, result)
+	return err
+}
+
+// requestPage sends a request to the API and decodes the result of the response envelope into result
+func (c *Client) requestPage(method string, path string, body interface{}, result interface{}) (*envelope, error) {
+	var reader io.Reader
+	if body != nil {
+		jsonStr, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		c.logger.Debugf("Request body: %s", string(jsonStr))
+		reader = bytes.NewBuffer(jsonStr)
+	}
+
+	req, err := http.NewRequest(method, c.apiURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Debug(string(bodyBytes))
+
+	response := envelope{}
+	err = json.Unmarshal(bodyBytes, &response)
+	if err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.New("Received status code " + strconv.Itoa(resp.StatusCode))
+		}
+		return nil, err
+	}
+	if !response.Success || resp.StatusCode != http.StatusOK {
+		messages := []string{}
+		for _, e := range response.Errors {
+			messages = append(messages, strconv.Itoa(e.Code)+": "+e.Message)
+		}
+		return nil, errors.New("request failed with status code " + strconv.Itoa(resp.StatusCode) + ": " + strings.Join(messages, ", "))
+	}
+
+	if result != nil {
+		err = json.Unmarshal(response.Result, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &response, nil
+}
+
+// absoluteName returns the full name of a record as used by Cloudflare
+func absoluteName(name string, domain string) string {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if name == "@" || name == "" {
+		return domain
+	}
+	return strings.ToLower(name) + "." + domain
+}
+
+// relativeName returns the name of a record relative to domain
+func relativeName(name string, domain string) string {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == domain {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+domain)
+}
@@ -0,0 +1,375 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+const (
+	testToken  = "test-token"
+	testZoneID = "zone-1"
+)
+
+// fakeAPI emulates the parts of the API v4 used by the client for the zone example.com. Record listings
+// are split into pages of perPage records.
+type fakeAPI struct {
+	t       *testing.T
+	mutex   sync.Mutex
+	perPage int
+	records []Record
+	nextID  int
+	// bodies records the raw bodies of write requests as "METHOD body"
+	bodies []string
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"success":false,"errors":[{"code":9109,"message":"Invalid access token"}]}`))
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	if len(body) > 0 {
+		a.bodies = append(a.bodies, r.Method+" "+string(body))
+	}
+
+	path := r.URL.Path
+	switch {
+	case path == "/zones":
+		zones := []zone{{ID: testZoneID, Name: "example.com"}, {ID: "zone-2", Name: "example.org"}}
+		if name := r.URL.Query().Get("name"); name != "" {
+			filtered := []zone{}
+			for _, z := range zones {
+				if z.Name == name {
+					filtered = append(filtered, z)
+				}
+			}
+			zones = filtered
+		}
+		a.writePage(w, r, zones, len(zones))
+	case path == "/zones/"+testZoneID+"/dns_records" && r.Method == http.MethodGet:
+		matching := []Record{}
+		for _, record := range a.records {
+			if (r.URL.Query().Get("type") == "" || record.Type == r.URL.Query().Get("type")) &&
+				(r.URL.Query().Get("name") == "" || record.Name == r.URL.Query().Get("name")) {
+				matching = append(matching, record)
+			}
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		start := (page - 1) * a.perPage
+		end := start + a.perPage
+		if start > len(matching) {
+			start = len(matching)
+		}
+		if end > len(matching) {
+			end = len(matching)
+		}
+		a.writePage(w, r, matching[start:end], len(matching))
+	case path == "/zones/"+testZoneID+"/dns_records" && r.Method == http.MethodPost:
+		record := Record{}
+		json.Unmarshal(body, &record)
+		a.nextID++
+		record.ID = "new-" + strconv.Itoa(a.nextID)
+		a.records = append(a.records, record)
+		a.write(w, record)
+	case strings.HasPrefix(path, "/zones/"+testZoneID+"/dns_records/"):
+		id := strings.TrimPrefix(path, "/zones/"+testZoneID+"/dns_records/")
+		for i, record := range a.records {
+			if record.ID != id {
+				continue
+			}
+			switch r.Method {
+			case http.MethodPatch:
+				patch := Record{}
+				json.Unmarshal(body, &patch)
+				a.records[i].Content, a.records[i].TTL = patch.Content, patch.TTL
+				if patch.Proxied != nil {
+					a.records[i].Proxied = patch.Proxied
+				}
+			case http.MethodDelete:
+				a.records = append(a.records[:i], a.records[i+1:]...)
+			}
+			a.write(w, map[string]string{"id": id})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"success":false,"errors":[{"code":81044,"message":"Record not found"}]}`))
+	default:
+		a.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (a *fakeAPI) writePage(w http.ResponseWriter, r *http.Request, result interface{}, total int) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page == 0 {
+		page = 1
+	}
+	perPage := a.perPage
+	if !strings.Contains(r.URL.Path, "dns_records") {
+		perPage = pageSize
+	}
+	totalPages := (total + perPage - 1) / perPage
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	resultJSON, _ := json.Marshal(result)
+	fmt.Fprintf(w, `{"success":true,"errors":[],"result":%s,"result_info":{"page":%d,"total_pages":%d}}`,
+		resultJSON, page, totalPages)
+}
+
+func (a *fakeAPI) write(w http.ResponseWriter, result interface{}) {
+	resultJSON, _ := json.Marshal(result)
+	fmt.Fprintf(w, `{"success":true,"errors":[],"result":%s}`, resultJSON)
+}
+
+// contents returns the records of the given name and type as "content ttl proxied", sorted
+func (a *fakeAPI) contents(name string, recordType string) []string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	result := []string{}
+	for _, record := range a.records {
+		if record.Name == name && record.Type == recordType {
+			proxied := "unset"
+			if record.Proxied != nil {
+				proxied = strconv.FormatBool(*record.Proxied)
+			}
+			result = append(result, fmt.Sprintf("%s %d %s", record.Content, record.TTL, proxied))
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func newTestClient(t *testing.T, proxied *bool, records ...Record) (*fakeAPI, *Client) {
+	t.Helper()
+	api := &fakeAPI{t: t, perPage: 2, records: records}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	client := NewClient(zap.NewNop(), testToken, proxied)
+	client.apiURL = server.URL
+	return api, client
+}
+
+func boolPointer(value bool) *bool {
+	return &value
+}
+
+func intPointer(value int) *int {
+	return &value
+}
+
+func expectContents(t *testing.T, got []string, expected ...string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestRecordsFollowsPagination(t *testing.T) {
+	_, client := newTestClient(t, nil,
+		Record{ID: "1", Type: "A", Name: "example.com", Content: "198.51.100.1", TTL: 1},
+		Record{ID: "2", Type: "A", Name: "home.example.com", Content: "198.51.100.2", TTL: 300},
+		Record{ID: "3", Type: "MX", Name: "example.com", Content: "mx.example.net", Priority: intPointer(10), TTL: 300},
+		Record{ID: "4", Type: "TXT", Name: "example.com", Content: "v=spf1 -all", TTL: 300},
+		Record{ID: "5", Type: "CNAME", Name: "www.example.com", Content: "example.com", TTL: 300},
+	)
+
+	records, err := client.Records("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, record := range records {
+		got = append(got, record.ID+" "+record.Name+" "+record.Type+" "+record.Content)
+	}
+	expectContents(t, got,
+		"1 @ A 198.51.100.1",
+		"2 home A 198.51.100.2",
+		"3 @ MX 10 mx.example.net",
+		"4 @ TXT v=spf1 -all",
+		"5 www CNAME example.com",
+	)
+}
+
+func TestUnknownZone(t *testing.T) {
+	_, client := newTestClient(t, nil)
+
+	_, err := client.Records("example.net")
+	if err == nil || !strings.Contains(err.Error(), "zone 'example.net' not found") {
+		t.Errorf("expected zone lookup to fail, got %v", err)
+	}
+}
+
+func TestUpsertRecordCreates(t *testing.T) {
+	api, client := newTestClient(t, nil)
+
+	err := client.UpsertRecord("example.com", "home", "A", "198.51.100.3", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectContents(t, api.contents("home.example.com", "A"), "198.51.100.3 300 unset")
+
+	// proxied must be omitted so that Cloudflare applies its default
+	if len(api.bodies) != 1 || strings.Contains(api.bodies[0], "proxied") {
+		t.Errorf("unexpected request bodies %v", api.bodies)
+	}
+}
+
+func TestUpsertRecordPatchesAndRemovesDuplicates(t *testing.T) {
+	api, client := newTestClient(t, nil,
+		Record{ID: "1", Type: "A", Name: "home.example.com", Content: "198.51.100.1", TTL: 300, Proxied: boolPointer(true)},
+		Record{ID: "2", Type: "A", Name: "home.example.com", Content: "198.51.100.2", TTL: 300},
+		Record{ID: "3", Type: "A", Name: "home.example.com", Content: "198.51.100.4", TTL: 300},
+		Record{ID: "4", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::1", TTL: 300},
+	)
+
+	err := client.UpsertRecord("example.com", "home", "A", "198.51.100.3", 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first record is patched in place and keeps its proxied setting
+	expectContents(t, api.contents("home.example.com", "A"), "198.51.100.3 600 true")
+	expectContents(t, api.contents("home.example.com", "AAAA"), "2001:db8::1 300 unset")
+	if !strings.HasPrefix(api.bodies[0], "PATCH ") || strings.Contains(api.bodies[0], "proxied") {
+		t.Errorf("expected a PATCH without proxied, got %v", api.bodies)
+	}
+}
+
+func TestUpsertRecordSetsProxied(t *testing.T) {
+	api, client := newTestClient(t, boolPointer(false),
+		Record{ID: "1", Type: "A", Name: "home.example.com", Content: "198.51.100.1", TTL: 300, Proxied: boolPointer(true)},
+	)
+
+	err := client.UpsertRecord("example.com", "home", "A", "198.51.100.3", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectContents(t, api.contents("home.example.com", "A"), "198.51.100.3 300 false")
+}
+
+func TestAddAndDeleteRecord(t *testing.T) {
+	api, client := newTestClient(t, boolPointer(true),
+		Record{ID: "1", Type: "TXT", Name: "_acme-challenge.example.com", Content: "old", TTL: 300},
+	)
+
+	err := client.AddRecord("example.com", "_acme-challenge", "TXT", "new", 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// TXT records can't be proxied
+	expectContents(t, api.contents("_acme-challenge.example.com", "TXT"), "new 120 unset", "old 300 unset")
+
+	err = client.DeleteRecord("example.com", "_acme-challenge", "TXT", `"old"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectContents(t, api.contents("_acme-challenge.example.com", "TXT"), "new 120 unset")
+
+	err = client.AddRecord("example.com", "@", "MX", "10 mx.example.net", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := api.bodies[len(api.bodies)-1]; !strings.Contains(body, `"content":"mx.example.net","priority":10`) {
+		t.Errorf("expected the MX priority to be sent separately, got %s", body)
+	}
+
+	err = client.DeleteRecords("example.com", "_acme-challenge", "TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectContents(t, api.contents("_acme-challenge.example.com", "TXT"))
+}
+
+func TestUpdateRecord(t *testing.T) {
+	api, client := newTestClient(t, nil,
+		Record{ID: "1", Type: "A", Name: "www.example.com", Content: "198.51.100.1", TTL: 300},
+		Record{ID: "2", Type: "A", Name: "www.example.com", Content: "198.51.100.2", TTL: 300},
+	)
+
+	err := client.UpdateRecord("example.com", "www", "A", "198.51.100.2", "198.51.100.3", 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectContents(t, api.contents("www.example.com", "A"), "198.51.100.1 300 unset", "198.51.100.3 600 unset")
+
+	err = client.UpdateRecord("example.com", "www", "A", "198.51.100.2", "198.51.100.4", 600)
+	if err == nil {
+		t.Error("expected the update of a missing record to fail")
+	}
+}
+
+func TestLookupRecords(t *testing.T) {
+	_, client := newTestClient(t, nil,
+		Record{ID: "1", Type: "A", Name: "home.example.com", Content: "198.51.100.1", TTL: 300, Proxied: boolPointer(true)},
+	)
+
+	contents, proxied, err := client.LookupRecords("example.com", "home", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectContents(t, contents, "198.51.100.1")
+	if !proxied {
+		t.Error("expected the record to be reported as proxied")
+	}
+
+	client.proxied = boolPointer(false)
+	_, proxied, err = client.LookupRecords("example.com", "home", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxied {
+		t.Error("expected the record not to be proxied after an update")
+	}
+}
+
+func TestDomains(t *testing.T) {
+	_, client := newTestClient(t, nil)
+
+	domains, err := client.Domains()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectContents(t, domains, "example.com", "example.org")
+}
+
+func TestInvalidToken(t *testing.T) {
+	_, client := newTestClient(t, nil)
+	client.token = "wrong"
+
+	_, err := client.Records("example.com")
+	if err == nil || !strings.Contains(err.Error(), "9109: Invalid access token") {
+		t.Errorf("expected the API error to be reported, got %v", err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	_, client := newTestClient(t, nil)
+	if err := client.Authenticate(); err != nil {
+		t.Errorf("expected the token to be accepted, got %v", err)
+	}
+
+	client.token = "wrong"
+	err := client.Authenticate()
+	if err == nil || !strings.Contains(err.Error(), "9109: Invalid access token") {
+		t.Errorf("expected the invalid token to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dschanoeh/hover-ddns/dnsprovider"
+	"go.uber.org/zap"
+)
+
+const commandUsage = `Commands:
+  auth-hook                                          certbot DNS-01 auth hook
+  cleanup-hook                                       certbot DNS-01 cleanup hook
+  domains list                                       list the domains of all providers
+  records list <domain>                              list all records of a domain
+  records set <domain> <name> <type> <content> [--ttl seconds]
+                                                     replace the records of a name and type
+  records delete <domain> <name> <type> [content]    delete the records of a name and type
+  export <domain>                                    print the records of a domain as zone file
+  plan <domain> <file> [--prune]                     show the changes needed to match a YAML or zone file
+  apply <domain> <file> [--prune] [--auto-approve]   make the records of a domain match a YAML or zone file
+`
+
+// runCommand executes one of the commands that can be given after the flags instead of running
+// the updater
+func runCommand(logger *zap.Logger, config *Config, args []string, output string) error {
+	switch strings.Join(firstN(args, 2), " ") {
+	case "domains list":
+		return listDomains(logger, config, args[2:], output)
+	case "records list":
+		return listRecords(logger, config, args[2:], output)
+	case "records set":
+		return setRecord(logger, config, args[2:])
+	case "records delete":
+		return deleteRecords(logger, config, args[2:])
+	}
+
+	switch args[0] {
+	case "export":
+		return exportZone(logger, config, args[1:])
+	case "plan", "apply":
+		return syncRecords(logger, config, args[1:], output, args[0] == "apply")
+	case "auth-hook", "cleanup-hook":
+		if len(args) > 1 {
+			return errors.New(args[0] + " doesn't take any arguments")
+		}
+		return runACMEHook(logger, config, args[0] == "cleanup-hook")
+	default:
+		flag.Usage()
+		return errors.New("unknown command '" + strings.Join(args, " ") + "'")
+	}
+}
+
+// validateCommandConfig checks the settings needed by command. Commands can be used without any
+// domains or lookup provider configured for the updater, the settings of the backend are checked
+// once the domain a command operates on is known.
+func validateCommandConfig(logger *zap.Logger, config *Config, command string) bool {
+	if (command == "auth-hook" || command == "cleanup-hook") && config.DNSServer == "" {
+		logger.Error("Invalid config: A DNS server must be provided to wait for the challenge record")
+		return false
+	}
+
+	return true
+}
+
+// commandProvider connects the backend of the given domain. Domains that aren't configured are
+// managed through Hover with the global credentials.
+func commandProvider(logger *zap.Logger, config *Config, domain string) (dnsprovider.Provider, *DomainConfig, error) {
+	domainConfig := findDomainConfig(config, domain)
+	if domainConfig == nil {
+		domainConfig = &DomainConfig{DomainName: domain}
+	}
+
+	err := validateProviderConfig(config, domainConfig)
+	if err != nil {
+		return nil, nil, errors.New("invalid provider config of '" + domain + "': " + err.Error())
+	}
+	backend, err := connectDNSProvider(logger, config, domainConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return backend, domainConfig, nil
+}
+
+// findDomainConfig returns the configured domain of the given name or nil
+func findDomainConfig(config *Config, domain string) *DomainConfig {
+	for i := range config.Domains {
+		if strings.EqualFold(strings.TrimSuffix(config.Domains[i].DomainName, "."), domain) {
+			return &config.Domains[i]
+		}
+	}
+	return nil
+}
+
+type domainEntry struct {
+	DomainName string `json:"domain_name"`
+	Provider   string `json:"provider"`
+}
+
+// listDomains lists the configured domains and, if global credentials are set, the domains of the
+// Hover account. Backends that can list their domains contribute all domains of their account.
+func listDomains(logger *zap.Logger, config *Config, args []string, output string) error {
+	if len(args) != 0 {
+		return errors.New("usage: domains list")
+	}
+
+	domainConfigs := []DomainConfig{}
+	domainConfigs = append(domainConfigs, config.Domains...)
+	if config.Username != "" && config.Password != "" {
+		domainConfigs = append(domainConfigs, DomainConfig{})
+	}
+	if len(domainConfigs) == 0 {
+		return errors.New("neither domains nor Hover credentials are configured")
+	}
+
+	entries := []domainEntry{}
+	seen := map[string]bool{}
+	for i := range domainConfigs {
+		domainConfig := &domainConfigs[i]
+		providerType := domainConfig.Provider.Type
+		if providerType == "" {
+			providerType = "hover"
+		}
+
+		if err := validateProviderConfig(config, domainConfig); err != nil {
+			return errors.New("invalid provider config of '" + domainConfig.DomainName + "': " + err.Error())
+		}
+		backend, err := newDNSProvider(logger, config, domainConfig)
+		if err != nil {
+			return err
+		}
+		names := []string{domainConfig.DomainName}
+		if lister, ok := backend.(dnsprovider.DomainLister); ok {
+			if err = backend.Authenticate(); err != nil {
+				return err
+			}
+			if names, err = lister.Domains(); err != nil {
+				return err
+			}
+		}
+
+		for _, name := range names {
+			name = strings.ToLower(strings.TrimSuffix(name, "."))
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			entries = append(entries, domainEntry{DomainName: name, Provider: providerType})
+		}
+	}
+
+	if output == "json" {
+		return writeJSON(os.Stdout, entries)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DOMAIN\tPROVIDER")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\n", entry.DomainName, entry.Provider)
+	}
+	return w.Flush()
+}
+
+func listRecords(logger *zap.Logger, config *Config, args []string, output string) error {
+	if len(args) != 1 {
+		return errors.New("usage: records list <domain>")
+	}
+	domain := strings.ToLower(strings.TrimSuffix(args[0], "."))
+
+	backend, _, err := commandProvider(logger, config, domain)
+	if err != nil {
+		return err
+	}
+	records, err := backend.Records(domain)
+	if err != nil {
+		return err
+	}
+
+	if output == "json" {
+		return writeJSON(os.Stdout, records)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tTYPE\tCONTENT")
+	for _, record := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", record.ID, record.Name, record.Type, record.Content)
+	}
+	return w.Flush()
+}
+
+func setRecord(logger *zap.Logger, config *Config, args []string) error {
+	flags := flag.NewFlagSet("records set", flag.ContinueOnError)
+	ttl := flags.Int("ttl", 0, "TTL of the record in seconds, defaults to the TTL of the domain's provider")
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 4 {
+		return errors.New("usage: records set <domain> <name> <type> <content> [--ttl seconds]")
+	}
+	domain, name, recordType, content := strings.ToLower(strings.TrimSuffix(positional[0], ".")), positional[1],
+		strings.ToUpper(positional[2]), positional[3]
+
+	if err = validateHostName(name, domain); err != nil {
+		return err
+	}
+
+	backend, domainConfig, err := commandProvider(logger, config, domain)
+	if err != nil {
+		return err
+	}
+	if *ttl == 0 {
+		*ttl = recordTTL(&domainConfig.Provider)
+	}
+	return backend.UpsertRecord(domain, name, recordType, content, *ttl)
+}
+
+func deleteRecords(logger *zap.Logger, config *Config, args []string) error {
+	if len(args) != 3 && len(args) != 4 {
+		return errors.New("usage: records delete <domain> <name> <type> [content]")
+	}
+	domain, name, recordType := strings.ToLower(strings.TrimSuffix(args[0], ".")), args[1], strings.ToUpper(args[2])
+
+	backend, _, err := commandProvider(logger, config, domain)
+	if err != nil {
+		return err
+	}
+	if len(args) == 4 {
+		return backend.DeleteRecord(domain, name, recordType, args[3])
+	}
+	return backend.DeleteRecords(domain, name, recordType)
+}
+
+// parseInterspersed parses flags that may appear between positional arguments and returns the
+// positional arguments
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	flags.SetOutput(io.Discard)
+	positional := []string{}
+	for {
+		err := flags.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+func writeJSON(w io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func firstN(args []string, n int) []string {
+	if len(args) < n {
+		return args
+	}
+	return args[:n]
+}
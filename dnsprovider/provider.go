@@ -0,0 +1,51 @@
+package dnsprovider
+
+import "go.uber.org/zap"
+
+// Record is a single DNS record of a domain. Names are relative to the domain with '@' denoting the apex.
+// Content is given in zone file presentation format, MX records include their priority and TXT records
+// are given without quotes.
+type Record struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+// Provider is a DNS backend that hosts the records of one or more domains
+type Provider interface {
+	// Authenticate establishes a session with the backend. It has to be called before any of the other methods.
+	Authenticate() error
+	// Records returns all records of the given domain
+	Records(domain string) ([]Record, error)
+	// UpsertRecord makes content the only record of the given name and type, creating it if necessary
+	UpsertRecord(domain string, name string, recordType string, content string, ttl int) error
+	// AddRecord creates a record without touching existing records of the same name and type
+	AddRecord(domain string, name string, recordType string, content string, ttl int) error
+	// DeleteRecords deletes all records of the given name and type
+	DeleteRecords(domain string, name string, recordType string) error
+	// DeleteRecord deletes the records of the given name and type that have the given content
+	DeleteRecord(domain string, name string, recordType string, content string) error
+	// WithLogger returns a provider that logs to logger and shares the session and state of this one
+	WithLogger(logger *zap.Logger) Provider
+}
+
+// DomainLister is implemented by providers that can list the domains of the account
+type DomainLister interface {
+	Domains() ([]string, error)
+}
+
+// RecordUpdater is implemented by providers that can change a single record in place
+type RecordUpdater interface {
+	// UpdateRecord changes content and TTL of the record of the given name and type that has oldContent
+	UpdateRecord(domain string, name string, recordType string, oldContent string, content string, ttl int) error
+}
+
+// RecordLookup is implemented by providers whose records can't be checked with DNS queries, e.g. because
+// a proxy answers them with its own addresses
+type RecordLookup interface {
+	// LookupRecords returns the contents of the records of the given name and type and whether they are,
+	// or after an update will be, served through a proxy
+	LookupRecords(domain string, name string, recordType string) ([]string, bool, error)
+}
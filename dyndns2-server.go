@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dschanoeh/hover-ddns/publicip"
+	"go.uber.org/zap"
+)
+
+const dynDNS2UpdatePath = "/nic/update"
+
+// DynDNS2ServerConfig enables an HTTP endpoint that accepts dyndns2 updates, e.g. from routers
+type DynDNS2ServerConfig struct {
+	ListenAddress string `yaml:"listen_address"`
+	Username      string `yaml:"username"`
+	Password      string `yaml:"password"`
+}
+
+type dynDNS2Server struct {
+	logger *zap.Logger
+	config *Config
+	// policy is applied to pushed addresses like to the looked up ones
+	policy *publicip.AddressPolicy
+	// ctx is done when the server is stopped, which also cancels running verifications
+	ctx context.Context
+
+	// verifications holds the cancel function of the running propagation verification of each host
+	verificationsMutex sync.Mutex
+	verifications      map[string]*verification
+}
+
+type verification struct {
+	cancel context.CancelFunc
+}
+
+// serveDynDNS2 starts listening for dyndns2 updates. Requests are handled in the background and update
+// the configured hosts named in the request with the pushed addresses. The server stops when ctx is done.
+func serveDynDNS2(ctx context.Context, logger *zap.Logger, config *Config) error {
+	policy, err := publicip.NewAddressPolicy(&config.PublicIPProvider.AddressPolicy)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", config.DynDNS2Server.ListenAddress)
+	if err != nil {
+		return err
+	}
+
+	server := &dynDNS2Server{
+		logger:        logger,
+		config:        config,
+		policy:        policy,
+		ctx:           ctx,
+		verifications: map[string]*verification{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(dynDNS2UpdatePath, server.handleUpdate)
+
+	httpServer := http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		err := httpServer.Serve(listener)
+		if err != http.ErrServerClosed {
+			logger.Sugar().Error("dyndns2 server stopped: ", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		httpServer.Close()
+	}()
+
+	logger.Sugar().Infof("Listening for dyndns2 updates on %s", listener.Addr().String())
+	return nil
+}
+
+func (s *dynDNS2Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	sugaredLogger := s.logger.Sugar()
+	username, password, ok := r.BasicAuth()
+	if !ok || !s.authorized(username, password) {
+		sugaredLogger.Warnf("Rejected dyndns2 update from %s with invalid credentials", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Basic realm="hover-ddns"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, "badauth")
+		return
+	}
+
+	query := r.URL.Query()
+	publicV4, publicV6, err := s.checkedAddresses(query.Get("myip"), query.Get("myipv6"), r.RemoteAddr)
+	if err != nil {
+		sugaredLogger.Warnf("Rejected dyndns2 update from %s: %s", r.RemoteAddr, err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, "911")
+		return
+	}
+
+	hostnames := strings.Split(query.Get("hostname"), ",")
+	known := s.knownHosts()
+	selected := map[string]bool{}
+	for _, hostname := range hostnames {
+		hostname = normalizeHostname(hostname)
+		if known[hostname] {
+			selected[hostname] = true
+		}
+	}
+
+	sugaredLogger.Infof("Received dyndns2 update from %s for %s", r.RemoteAddr, query.Get("hostname"))
+	// Pushed updates must not overlap with scheduled ones
+	plans := []hostPlan{}
+	if len(selected) > 0 {
+		runMutex.Lock()
+		plans, _ = updateHosts(s.logger, s.config, publicV4, publicV6, false, selected)
+		runMutex.Unlock()
+	}
+
+	// Routers don't wait for the verification, its outcome is only logged
+	if s.config.VerifyPropagation {
+		s.verify(plans)
+	}
+
+	// One return code per requested host name, in the order of the request
+	addresses := []string{}
+	for _, ip := range []net.IP{publicV4, publicV6} {
+		if ip != nil {
+			addresses = append(addresses, ip.String())
+		}
+	}
+	for _, hostname := range hostnames {
+		hostname = normalizeHostname(hostname)
+		switch {
+		case hostname == "":
+			fmt.Fprintln(w, "notfqdn")
+		case !known[hostname]:
+			fmt.Fprintln(w, "nohost")
+		default:
+			fmt.Fprintln(w, returnCode(plans, hostname)+" "+strings.Join(addresses, ","))
+		}
+	}
+}
+
+// verify verifies the propagation of the updates in plans in the background. Each host has at most one
+// running verification, a newer update of a host cancels the verification of the previous one.
+func (s *dynDNS2Server) verify(plans []hostPlan) {
+	hostPlans := map[string][]hostPlan{}
+	for _, plan := range plans {
+		if plan.Action == actionUpdate && plan.Error == "" {
+			hostPlans[plan.Host] = append(hostPlans[plan.Host], plan)
+		}
+	}
+
+	s.verificationsMutex.Lock()
+	defer s.verificationsMutex.Unlock()
+	for host, plans := range hostPlans {
+		if running, ok := s.verifications[host]; ok {
+			running.cancel()
+		}
+		ctx, cancel := context.WithCancel(s.ctx)
+		current := &verification{cancel: cancel}
+		s.verifications[host] = current
+
+		go func(host string, plans []hostPlan) {
+			verifyPropagation(ctx, s.logger, s.config, plans)
+			cancel()
+
+			s.verificationsMutex.Lock()
+			defer s.verificationsMutex.Unlock()
+			if s.verifications[host] == current {
+				delete(s.verifications, host)
+			}
+		}(host, plans)
+	}
+}
+
+func (s *dynDNS2Server) authorized(username string, password string) bool {
+	userMatch := subtle.ConstantTimeCompare([]byte(username), []byte(s.config.DynDNS2Server.Username)) == 1
+	passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(s.config.DynDNS2Server.Password)) == 1
+	return userMatch && passwordMatch
+}
+
+// knownHosts returns the fully qualified names of all configured hosts
+func (s *dynDNS2Server) knownHosts() map[string]bool {
+	known := map[string]bool{}
+	for _, domain := range s.config.Domains {
+		for _, host := range domain.Hosts {
+			known[normalizeHostname(recordFQDN(host.Name, domain.DomainName))] = true
+		}
+	}
+	return known
+}
+
+// checkedAddresses returns the pushed addresses of the enabled families. Addresses that the address policy
+// rejects, like private addresses of a router behind another NAT, fail the whole update so that they are
+// never published.
+func (s *dynDNS2Server) checkedAddresses(myIP string, myIPv6 string, remoteAddr string) (net.IP, net.IP, error) {
+	publicV4, publicV6, err := pushedAddresses(myIP, myIPv6, remoteAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.config.DisableV4 {
+		publicV4 = nil
+	}
+	if s.config.DisableV6 {
+		publicV6 = nil
+	}
+	if publicV4 == nil && publicV6 == nil {
+		return nil, nil, errors.New("no address of an enabled family was given")
+	}
+
+	if publicV4 != nil {
+		if err = s.policy.Check(publicV4, false); err != nil {
+			return nil, nil, err
+		}
+	}
+	if publicV6 != nil {
+		if err = s.policy.Check(publicV6, true); err != nil {
+			return nil, nil, err
+		}
+	}
+	return publicV4, publicV6, nil
+}
+
+// returnCode derives the dyndns2 return code of a host from the plan of its update. Address families that
+// were not pushed are ignored.
+func returnCode(plans []hostPlan, hostname string) string {
+	code := "nochg"
+	for _, plan := range plans {
+		if normalizeHostname(plan.Host) != hostname || plan.Action == actionSkip {
+			continue
+		}
+		if plan.Error != "" {
+			return "911"
+		}
+		if plan.Action == actionUpdate {
+			code = "good"
+		}
+	}
+	return code
+}
+
+// pushedAddresses parses the addresses of an update request. myip may contain an IPv4 and an IPv6 address
+// separated by a comma. If no address is given, the address of the client is used.
+func pushedAddresses(myIP string, myIPv6 string, remoteAddr string) (net.IP, net.IP, error) {
+	values := []string{}
+	for _, value := range strings.Split(myIP+","+myIPv6, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		host, _, err := net.SplitHostPort(remoteAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+		values = append(values, host)
+	}
+
+	var publicV4, publicV6 net.IP
+	for _, value := range values {
+		ip := net.ParseIP(value)
+		switch {
+		case ip == nil:
+			return nil, nil, errors.New("'" + value + "' is not a valid IP address")
+		case ip.To4() != nil:
+			publicV4 = ip.To4()
+		default:
+			publicV6 = ip
+		}
+	}
+
+	return publicV4, publicV6, nil
+}
+
+func normalizeHostname(hostname string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(hostname), "."))
+}
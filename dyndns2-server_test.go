@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPushedAddresses(t *testing.T) {
+	tests := []struct {
+		name     string
+		myIP     string
+		myIPv6   string
+		expected string
+		err      string
+	}{
+		{"ipv4", "198.51.100.1", "", "198.51.100.1 <nil>", ""},
+		{"both in myip", "198.51.100.1,2001:db8::1", "", "198.51.100.1 2001:db8::1", ""},
+		{"myipv6", "198.51.100.1", "2001:db8::1", "198.51.100.1 2001:db8::1", ""},
+		{"only ipv6", "", " 2001:db8::1 ", "<nil> 2001:db8::1", ""},
+		{"client address", "", "", "203.0.113.7 <nil>", ""},
+		{"invalid", "home", "", "", "'home' is not a valid IP address"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			publicV4, publicV6, err := pushedAddresses(test.myIP, test.myIPv6, "203.0.113.7:51234")
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := publicV4.String() + " " + publicV6.String(); got != test.expected {
+				t.Errorf("got %s, want %s", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestReturnCode(t *testing.T) {
+	plan := func(host string, action string, err string) hostPlan {
+		return hostPlan{Host: host, Action: action, Error: err}
+	}
+
+	tests := []struct {
+		name     string
+		plans    []hostPlan
+		expected string
+	}{
+		{"unchanged", []hostPlan{plan("home.example.com", actionNone, "")}, "nochg"},
+		{"updated", []hostPlan{plan("home.example.com", actionNone, ""), plan("home.example.com", actionUpdate, "")}, "good"},
+		{"failed", []hostPlan{plan("home.example.com", actionUpdate, ""), plan("home.example.com", actionUpdate, "refused")}, "911"},
+		{"family not pushed", []hostPlan{plan("home.example.com", actionUpdate, ""), plan("home.example.com", actionSkip, "")}, "good"},
+		{"other host", []hostPlan{plan("www.example.com", actionUpdate, "refused")}, "nochg"},
+		{"case of the plan", []hostPlan{plan("Home.example.com.", actionUpdate, "")}, "good"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if code := returnCode(test.plans, "home.example.com"); code != test.expected {
+				t.Errorf("got %s, want %s", code, test.expected)
+			}
+		})
+	}
+}
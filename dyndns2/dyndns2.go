@@ -0,0 +1,294 @@
+package dyndns2
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dschanoeh/hover-ddns/dnsprovider"
+	"go.uber.org/zap"
+)
+
+const (
+	userAgent = "hover-ddns"
+	// serverErrorBackoff is the minimum time to wait after a '911' or 'dnserr' response as required by the protocol
+	serverErrorBackoff = 30 * time.Minute
+)
+
+// Client sends updates with the dyndns2 protocol, e.g. to DynDNS, No-IP, Dynu or afraid.org.
+// The protocol only allows setting addresses, so records can neither be listed nor deleted.
+//
+// Responses that the protocol forbids to retry are remembered: after 'badauth', 'badagent' or '!donator'
+// no further updates are sent, after 'abuse', 'nohost', 'notfqdn' or 'numhost' the host name is blocked
+// and after '911' or 'dnserr' updates are paused for 30 minutes. This state is kept in a file per
+// update URL and credentials, so that it survives restarts and single runs.
+type Client struct {
+	logger     *zap.SugaredLogger
+	httpClient *http.Client
+	updateURL  string
+	username   string
+	password   string
+	// statePath is the file the backoff state is persisted in. The state is only kept in memory if empty.
+	statePath string
+
+	// backoff is shared with the clients returned by WithLogger
+	backoff *backoff
+}
+
+type backoff struct {
+	mutex sync.Mutex
+	state backoffState
+}
+
+type backoffState struct {
+	Disabled     string            `json:"disabled,omitempty"`
+	BlockedHosts map[string]string `json:"blocked_hosts,omitempty"`
+	RetryAfter   time.Time         `json:"retry_after,omitempty"`
+}
+
+// NewClient creates a client for the given update URL. The backoff state is loaded from and saved to
+// stateDirectory unless it is empty.
+func NewClient(logger *zap.Logger, updateURL string, username string, password string, stateDirectory string) (*Client, error) {
+	parsed, err := url.Parse(updateURL)
+	if err != nil || parsed.Host == "" {
+		return nil, errors.New("'" + updateURL + "' is not a valid update URL")
+	}
+
+	client := &Client{
+		logger:     logger.Sugar(),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		updateURL:  updateURL,
+		username:   username,
+		password:   password,
+		backoff:    &backoff{state: backoffState{BlockedHosts: map[string]string{}}},
+	}
+	if stateDirectory != "" {
+		client.statePath = filepath.Join(stateDirectory, stateFileName(updateURL, username, password))
+		err = client.loadState()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// stateFileName derives the name of the state file from the account, so that changing the credentials
+// starts over with a clean state
+func stateFileName(updateURL string, username string, password string) string {
+	sum := sha256.Sum256([]byte(updateURL + "\n" + username + "\n" + password))
+	return "dyndns2-" + hex.EncodeToString(sum[:8]) + ".json"
+}
+
+func (c *Client) loadState() error {
+	content, err := os.ReadFile(c.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return errors.New("could not read the state file: " + err.Error())
+	}
+
+	err = json.Unmarshal(content, &c.backoff.state)
+	if err != nil {
+		return errors.New("could not parse the state file " + c.statePath + ": " + err.Error())
+	}
+	if c.backoff.state.BlockedHosts == nil {
+		c.backoff.state.BlockedHosts = map[string]string{}
+	}
+	return nil
+}
+
+// saveState writes the backoff state to a temporary file that replaces the state file, so that an
+// interrupted write doesn't leave a broken file. The mutex has to be held.
+func (c *Client) saveState() error {
+	if c.statePath == "" {
+		return nil
+	}
+
+	content, err := json.Marshal(c.backoff.state)
+	if err != nil {
+		return err
+	}
+	directory := filepath.Dir(c.statePath)
+	err = os.MkdirAll(directory, 0700)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(directory, ".dyndns2-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), c.statePath)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+// WithLogger returns a client that logs to logger and shares the backoff state of this one
+func (c *Client) WithLogger(logger *zap.Logger) dnsprovider.Provider {
+	client := *c
+	client.logger = logger.Sugar()
+	return &client
+}
+
+// Authenticate does nothing as the credentials are sent with every update
+func (c *Client) Authenticate() error {
+	return nil
+}
+
+func (c *Client) Records(domain string) ([]dnsprovider.Record, error) {
+	return nil, errors.New("the dyndns2 protocol doesn't support listing records")
+}
+
+// UpsertRecord sets the address of the host. Only A and AAAA records are supported, the TTL is chosen
+// by the service.
+func (c *Client) UpsertRecord(domain string, name string, recordType string, content string, ttl int) error {
+	if recordType != "A" && recordType != "AAAA" {
+		return errors.New("the dyndns2 protocol only supports A and AAAA records")
+	}
+	hostname := hostName(name, domain)
+
+	err := c.checkBackoff(hostname)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"hostname": {hostname}, "myip": {content}}
+	target := c.updateURL
+	if strings.Contains(target, "?") {
+		target += "&" + query.Encode()
+	} else {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Header.Set("User-Agent", userAgent)
+
+	c.logger.Infof("Sending update of %s to %s...", hostname, content)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	c.logger.Debug(string(bodyBytes))
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return c.handleResponse(hostname, "badauth")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("Received status code " + strconv.Itoa(resp.StatusCode))
+	}
+
+	// Only a single host name is sent, so only the first line is of interest
+	line := strings.TrimSpace(strings.SplitN(string(bodyBytes), "\n", 2)[0])
+	return c.handleResponse(hostname, line)
+}
+
+func (c *Client) AddRecord(domain string, name string, recordType string, content string, ttl int) error {
+	return errors.New("the dyndns2 protocol doesn't support adding records")
+}
+
+func (c *Client) DeleteRecords(domain string, name string, recordType string) error {
+	return errors.New("the dyndns2 protocol doesn't support deleting records")
+}
+
+func (c *Client) DeleteRecord(domain string, name string, recordType string, content string) error {
+	return errors.New("the dyndns2 protocol doesn't support deleting records")
+}
+
+// checkBackoff returns an error if the protocol forbids sending an update for hostname right now
+func (c *Client) checkBackoff(hostname string) error {
+	c.backoff.mutex.Lock()
+	defer c.backoff.mutex.Unlock()
+
+	if c.backoff.state.Disabled != "" {
+		return errors.New("updates are disabled after a '" + c.backoff.state.Disabled + "' response, please check the configuration")
+	}
+	if reason, ok := c.backoff.state.BlockedHosts[hostname]; ok {
+		return errors.New("updates of " + hostname + " are disabled after a '" + reason + "' response")
+	}
+	if time.Now().Before(c.backoff.state.RetryAfter) {
+		return errors.New("server reported an error, backing off until " + c.backoff.state.RetryAfter.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// handleResponse interprets the return code of an update and records any backoff it requires
+func (c *Client) handleResponse(hostname string, response string) error {
+	c.backoff.mutex.Lock()
+	defer c.backoff.mutex.Unlock()
+
+	code := ""
+	if fields := strings.Fields(response); len(fields) > 0 {
+		code = fields[0]
+	}
+	switch code {
+	case "good":
+		c.logger.Infof("Update of %s succeeded", hostname)
+		return nil
+	case "nochg":
+		c.logger.Infof("Address of %s was already up to date", hostname)
+		return nil
+	case "badauth", "badagent", "!donator":
+		c.backoff.state.Disabled = code
+		c.persistState()
+		return errors.New("update rejected with '" + code + "', not sending any further updates")
+	case "abuse", "nohost", "notfqdn", "numhost":
+		c.backoff.state.BlockedHosts[hostname] = code
+		c.persistState()
+		return errors.New("update of " + hostname + " rejected with '" + code + "', not updating it any further")
+	case "911", "dnserr":
+		c.backoff.state.RetryAfter = time.Now().Add(serverErrorBackoff)
+		c.persistState()
+		return errors.New("server reported '" + code + "', backing off for " + serverErrorBackoff.String())
+	default:
+		return errors.New("unexpected response '" + response + "'")
+	}
+}
+
+// persistState saves the backoff state. Failing to do so is only logged, as the state is still kept
+// in memory. The mutex has to be held.
+func (c *Client) persistState() {
+	err := c.saveState()
+	if err != nil {
+		c.logger.Errorf("Could not save the backoff state to %s: %s", c.statePath, err)
+	}
+}
+
+// hostName returns the fully qualified name of a host of domain
+func hostName(name string, domain string) string {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if name == "@" || name == "" {
+		return domain
+	}
+	return strings.ToLower(name) + "." + domain
+}
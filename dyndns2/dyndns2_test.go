@@ -0,0 +1,88 @@
+package dyndns2
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// startUpdateServer answers every update with response and counts the requests
+func startUpdateServer(t *testing.T, response string) (string, *int) {
+	t.Helper()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintln(w, response)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/nic/update", &requests
+}
+
+func TestBackoffSurvivesRestart(t *testing.T) {
+	tests := []struct {
+		response string
+		err      string
+	}{
+		{"badauth", "disabled after a 'badauth' response"},
+		{"nohost", "updates of home.example.net are disabled after a 'nohost' response"},
+		{"911", "backing off until"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.response, func(t *testing.T) {
+			updateURL, requests := startUpdateServer(t, test.response)
+			directory := t.TempDir()
+
+			client, err := NewClient(zap.NewNop(), updateURL, "user", "password", directory)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = client.UpsertRecord("example.net", "home", "A", "198.51.100.1", 0); err == nil {
+				t.Fatal("expected the update to fail")
+			}
+
+			// A new client, like the one of the next --once run, must not send another update
+			client, err = NewClient(zap.NewNop(), updateURL, "user", "password", directory)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = client.UpsertRecord("example.net", "home", "A", "198.51.100.1", 0)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error containing '%s', got %v", test.err, err)
+			}
+			if *requests != 1 {
+				t.Errorf("expected a single request, got %d", *requests)
+			}
+
+			// Other credentials start with a clean state
+			client, err = NewClient(zap.NewNop(), updateURL, "user", "new password", directory)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.UpsertRecord("example.net", "home", "A", "198.51.100.1", 0)
+			if *requests != 2 {
+				t.Errorf("expected the update with new credentials to be sent, got %d requests", *requests)
+			}
+		})
+	}
+}
+
+func TestBrokenStateFile(t *testing.T) {
+	directory := t.TempDir()
+	updateURL := "https://dyndns.example.net/nic/update"
+	path := filepath.Join(directory, stateFileName(updateURL, "user", "password"))
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewClient(zap.NewNop(), updateURL, "user", "password", directory)
+	if err == nil || !strings.Contains(err.Error(), "could not parse the state file") {
+		t.Errorf("expected the broken state file to be reported, got %v", err)
+	}
+}
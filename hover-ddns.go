@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
-	"github.com/dschanoeh/hover-ddns/hover"
+	"github.com/dschanoeh/hover-ddns/dnsprovider"
 	"github.com/dschanoeh/hover-ddns/publicip"
 	"github.com/miekg/dns"
 	"github.com/robfig/cron/v3"
@@ -28,13 +33,44 @@ type Config struct {
 	PublicIPProvider publicip.LookupProviderConfig `yaml:"public_ip_provider"`
 	DNSServer        string                        `yaml:"dns_server"`
 	CronExpression   string                        `yaml:"cron_expression"`
+	IPv6PrefixLength int                           `yaml:"ipv6_prefix_length"`
+	// DisableAddressEvents turns off immediate updates on address changes of the local_interface provider
+	DisableAddressEvents bool `yaml:"disable_address_events"`
+	// VerifyPropagation waits after updates until the authoritative nameservers serve the new addresses
+	VerifyPropagation   bool          `yaml:"verify_propagation"`
+	PropagationTimeout  time.Duration `yaml:"propagation_timeout"`
+	PropagationInterval time.Duration `yaml:"propagation_interval"`
+	// ParallelHosts limits how many hosts are checked and updated at the same time
+	ParallelHosts int `yaml:"parallel_hosts"`
+	// DynDNS2Server accepts addresses pushed by routers via the dyndns2 protocol
+	DynDNS2Server DynDNS2ServerConfig `yaml:"dyndns2_server"`
+	// StateDirectory keeps state that has to survive restarts, like the backoff of dyndns2 providers
+	StateDirectory string `yaml:"state_directory"`
 }
 
 type DomainConfig struct {
-	DomainName string   `yaml:"domain_name"`
-	Hosts      []string `yaml:"hosts"`
+	DomainName string         `yaml:"domain_name"`
+	Provider   ProviderConfig `yaml:"provider"`
+	Hosts      []HostConfig   `yaml:"hosts"`
 }
 
+// HostConfig describes a single host record. Hosts can either be given as a plain name or as a mapping
+// that additionally specifies an IPv6 interface identifier. If an interface identifier is provided, the
+// AAAA record is built from the delegated prefix of the public IPv6 address and that identifier.
+type HostConfig struct {
+	Name       string `yaml:"name"`
+	IPv6Suffix string `yaml:"ipv6_suffix"`
+}
+
+const (
+	defaultIPv6PrefixLength    = 64
+	defaultPropagationTimeout  = 5 * time.Minute
+	defaultPropagationInterval = 10 * time.Second
+	defaultParallelHosts       = 4
+	// addressEventDebounce is the time to wait for further address changes before an update is triggered
+	addressEventDebounce = 5 * time.Second
+)
+
 var (
 	version = "dev"
 	commit  = "none"
@@ -42,21 +78,35 @@ var (
 	builtBy = "unknown"
 
 	cronScheduler = cron.New()
+	// runMutex makes sure that scheduled and event triggered updates don't overlap
+	runMutex sync.Mutex
 )
 
 func main() {
 	config := Config{}
 	var verbose = flag.Bool("verbose", false, "Turns on verbose information on the update process. Otherwise, only errors cause output.")
 	var debug = flag.Bool("debug", false, "Turns on debug information")
-	var dryRun = flag.Bool("dry-run", false, "Perform lookups but don't actually update the DNS info. Returns after a single check.")
+	var once = flag.Bool("once", false, "Perform a single update and exit with code 0 on success, 2 if an error occurred or 3 if an update didn't propagate in time.")
+	var dryRun = flag.Bool("dry-run", false, "Perform lookups but don't actually update the DNS info. Prints the plan and returns after a single check with exit code 0 (up to date), 1 (changes pending) or 2 (error).")
 	var configFile = flag.String("config", "", "Config file")
 	var manualV4 = flag.String("manual-ipv4", "", "Specify the IP address to be submitted instead of looking it up")
 	var manualV6 = flag.String("manual-ipv6", "", "Specify the IP address to be submitted instead of looking it up")
 	var versionFlag = flag.Bool("version", false, "Prints version information of the hover-ddns binary")
 	var onlyValidateConfig = flag.String("validate-config", "", "Only check if the provided config file is valid")
+	var output = flag.String("output", "text", "Output format of commands and dry runs: text or json")
 
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprint(flag.CommandLine.Output(), "\n"+commandUsage)
+	}
 	flag.Parse()
 
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "'%s' is not a valid output format\n", *output)
+		os.Exit(exitError)
+	}
+
 	if *versionFlag {
 		fmt.Printf("hover-ddns version %s, commit %s, built at %s by %s\n", version, commit, date, builtBy)
 		os.Exit(0)
@@ -79,10 +129,10 @@ func main() {
 		err := loadConfig(*onlyValidateConfig, &config)
 		if err != nil {
 			sugaredLogger.Error("Could not load config file: ", err)
-			os.Exit(1)
+			os.Exit(exitError)
 		}
 		if !validateConfig(logger, &config) {
-			os.Exit(1)
+			os.Exit(exitError)
 		}
 		os.Exit(0)
 	}
@@ -90,89 +140,306 @@ func main() {
 	if *configFile == "" {
 		sugaredLogger.Error("Please provide a config file to read")
 		flag.Usage()
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 
 	err := loadConfig(*configFile, &config)
 	if err != nil {
 		sugaredLogger.Error("Could not load config file: ", err)
-		os.Exit(1)
+		os.Exit(exitError)
+	}
+
+	// Commands only need the settings they use, so they are dispatched before the updater config is validated
+	if flag.NArg() > 0 {
+		if !validateCommandConfig(logger, &config, flag.Arg(0)) {
+			os.Exit(exitError)
+		}
+		err = runCommand(logger, &config, flag.Args(), *output)
+		if err != nil {
+			sugaredLogger.Error("Command failed: ", err)
+			os.Exit(exitError)
+		}
+		os.Exit(0)
 	}
+
 	if !validateConfig(logger, &config) {
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 
 	var provider publicip.LookupProvider
 	provider, err = publicip.NewLookupProvider(logger, &config.PublicIPProvider)
 	if err != nil {
 		sugaredLogger.Error("Could not configure public ip provider: ", err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 
 	// Perform a first run immediately
 	sugaredLogger.Info("Performing first update")
-	run(logger, &config, provider, dryRun, manualV4, manualV6)
+	plans, err := run(logger, &config, provider, dryRun, manualV4, manualV6)
 
 	// If a dry-run was requested, we're done now and can terminate
 	if *dryRun {
-		return
+		if writeErr := writeHostPlans(os.Stdout, plans, *output); writeErr != nil {
+			sugaredLogger.Error("Could not write plan: ", writeErr)
+			os.Exit(exitError)
+		}
+		os.Exit(exitCode(plans, err, true))
+	}
+
+	// A single update was requested, e.g. by a systemd timer
+	if *once {
+		os.Exit(exitCode(plans, err, false))
 	}
 
 	// Schedule periodic calls
 	executeFunction := func() {
+		runMutex.Lock()
+		defer runMutex.Unlock()
 		run(logger, &config, provider, dryRun, manualV4, manualV6)
 	}
 	_, err = cronScheduler.AddFunc(config.CronExpression, executeFunction)
 	if err != nil {
 		sugaredLogger.Error("Was not able to schedule periodic execution: ", err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 	cronScheduler.Start()
 	logger.Info("Waiting for future scheduled updates")
 
+	// Additionally update right away when the addresses of the local interface change
+	if config.PublicIPProvider.Service == "local_interface" && !config.DisableAddressEvents {
+		err = watchAddressChanges(logger, config.PublicIPProvider.InterfaceName, executeFunction)
+		if err != nil {
+			sugaredLogger.Warn("Not able to watch for address changes, relying on scheduled updates: ", err)
+		}
+	}
+
+	// Background work like the dyndns2 server is stopped when a signal is received
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Accept addresses pushed by routers in addition to the scheduled lookups
+	if config.DynDNS2Server.ListenAddress != "" {
+		err = serveDynDNS2(ctx, logger, &config)
+		if err != nil {
+			sugaredLogger.Error("Could not start dyndns2 server: ", err)
+			os.Exit(exitError)
+		}
+	}
+
 	// We'll wait here until we receive a signal
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	sig := <-c
 	sugaredLogger.Warn("Received signal " + sig.String())
+	cancel()
 	cronScheduler.Stop()
 	os.Exit(0)
 }
 
-func run(logger *zap.Logger, config *Config, provider publicip.LookupProvider, dryRun *bool, manualV4 *string, manualV6 *string) {
-	var client *hover.HoverClient
-	var err error
-	sugaredLogger := logger.Sugar()
-
+// run updates all configured hosts once and returns what was planned for each host and address family
+func run(logger *zap.Logger, config *Config, provider publicip.LookupProvider, dryRun *bool, manualV4 *string, manualV6 *string) ([]hostPlan, error) {
 	publicV4, publicV6 := determinePublicIPs(logger, config, provider, manualV4, manualV6)
+	plans, err := updateHosts(logger, config, publicV4, publicV6, *dryRun, nil)
 
-	for _, domain := range config.Domains {
-		for _, hostName := range domain.Hosts {
-			sugaredLogger.Infof("--- Processing host %s.%s ---", hostName, domain.DomainName)
-			v4, v6 := hostNeedsUpdating(logger, domain.DomainName, hostName, publicV4, publicV6, config)
-
-			if !*dryRun {
-				// Attempt hover login when the first entry that requires updating is discovered
-				if (v4 != nil || v6 != nil) && !client.IsAuthenticated() {
-					client = hover.NewClient(logger)
-					err = client.Login(config.Username, config.Password)
-					if err != nil {
-						sugaredLogger.Error("Could not log in: ", err)
-						return
-					}
-				}
+	if config.VerifyPropagation && !*dryRun {
+		verifyPropagation(context.Background(), logger, config, plans)
+	}
+	return plans, err
+}
+
+// providerUpdates serializes the updates of the domains of one DNS provider account and holds the
+// provider during a run, so that every account is only connected once per run
+type providerUpdates struct {
+	mutex      sync.Mutex
+	backend    dnsprovider.Provider
+	backendErr error
+}
+
+// connect authenticates the DNS provider of the domain on first use. The error is kept so that the
+// remaining hosts don't try again. The mutex has to be held.
+func (u *providerUpdates) connect(logger *zap.Logger, config *Config, domain *DomainConfig) (dnsprovider.Provider, error) {
+	if u.backend == nil && u.backendErr == nil {
+		u.backend, u.backendErr = connectDNSProvider(logger, config, domain)
+		if u.backendErr != nil {
+			logger.Sugar().Errorf("Could not connect to the DNS provider of %s: %s", domain.DomainName, u.backendErr)
+		}
+	}
+	return u.backend, u.backendErr
+}
+
+type hostJob struct {
+	domain  *DomainConfig
+	updates *providerUpdates
+	host    HostConfig
+}
 
-				if !(v4 == nil && v6 == nil) {
-					err := client.Update(domain.DomainName, hostName, v4, v6)
-					if err != nil {
-						sugaredLogger.Error("Was not able to update hover records: ", err)
-						return
-					}
+// updateHosts points the records of the configured hosts to the given addresses. If selected is not nil,
+// only hosts whose fully qualified name is contained are processed. Up to config.ParallelHosts hosts are
+// processed at the same time, while updates through the same DNS provider account are made one after
+// another.
+func updateHosts(logger *zap.Logger, config *Config, publicV4 net.IP, publicV6 net.IP, dryRun bool, selected map[string]bool) ([]hostPlan, error) {
+	jobs := []hostJob{}
+	accounts := map[string]*providerUpdates{}
+	for i := range config.Domains {
+		domain := &config.Domains[i]
+		key := providerKey(config, domain)
+		updates, ok := accounts[key]
+		if !ok {
+			updates = &providerUpdates{}
+			accounts[key] = updates
+		}
+		for _, host := range domain.Hosts {
+			if selected != nil && !selected[strings.ToLower(recordFQDN(host.Name, domain.DomainName))] {
+				continue
+			}
+			jobs = append(jobs, hostJob{domain: domain, updates: updates, host: host})
+		}
+	}
+
+	results := make([][]hostPlan, len(jobs))
+	errs := make([]error, len(jobs))
+	workers := make(chan struct{}, config.ParallelHosts)
+	var wg sync.WaitGroup
+	for i := range jobs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			results[i], errs[i] = processHost(logger, config, jobs[i], publicV4, publicV6, dryRun)
+		}(i)
+	}
+	wg.Wait()
+
+	// Plans are returned in the order of the config regardless of which host finished first
+	var runErr error
+	plans := []hostPlan{}
+	for i := range jobs {
+		plans = append(plans, results[i]...)
+		if errs[i] != nil {
+			runErr = errs[i]
+		}
+	}
+
+	return plans, runErr
+}
+
+// processHost checks the records of a single host and updates them if needed. Log lines are tagged
+// with the name of the host.
+func processHost(logger *zap.Logger, config *Config, job hostJob, publicV4 net.IP, publicV6 net.IP, dryRun bool) ([]hostPlan, error) {
+	var err error
+	domain := job.domain
+	hostName := job.host.Name
+	fqdn := recordFQDN(hostName, domain.DomainName)
+	hostLogger := logger.With(zap.String("host", fqdn))
+	sugaredLogger := hostLogger.Sugar()
+	plans := []hostPlan{}
+
+	sugaredLogger.Infof("--- Processing host %s ---", fqdn)
+	hostV6 := publicV6
+	v6Error := ""
+	if job.host.IPv6Suffix != "" && publicV6 != nil {
+		hostV6, err = hostIPv6(publicV6, config.IPv6PrefixLength, job.host.IPv6Suffix)
+		if err != nil {
+			sugaredLogger.Errorf("Could not build IPv6 address for host %s: %s", hostName, err)
+			hostV6 = nil
+			v6Error = "could not build host address: " + err.Error()
+		} else {
+			sugaredLogger.Infof("Built host IPv6 %s from delegated prefix", hostV6.String())
+		}
+	}
+
+	// A family without public address, e.g. IPv6 on IPv4-only connections, is skipped as the failed lookup
+	// was already logged. It only counts as error if no family has an address at all, or if the host
+	// address couldn't be built.
+	v4Error := ""
+	if publicV4 == nil && publicV6 == nil {
+		v4Error = "could not determine any public address"
+		if v6Error == "" {
+			v6Error = v4Error
+		}
+	}
+	if !config.DisableV4 && publicV4 == nil {
+		plans = append(plans, hostPlan{Host: fqdn, Family: familyIPv4, Current: []string{}, Action: actionSkip,
+			Error: v4Error})
+	}
+	if !config.DisableV6 && hostV6 == nil {
+		plans = append(plans, hostPlan{Host: fqdn, Family: familyIPv6, Current: []string{}, Action: actionSkip,
+			Error: v6Error})
+	}
+
+	updates := job.updates
+
+	// Providers that can't be checked through DNS are asked for the current records instead. The lookups
+	// share the session and caches of the provider, so they are serialized like the updates.
+	var lookup recordLookup
+	if backend, err := cachedDNSProvider(logger, config, domain); err == nil {
+		if _, ok := backend.(dnsprovider.RecordLookup); ok {
+			lookup = func(recordType string) ([]string, bool, error) {
+				updates.mutex.Lock()
+				defer updates.mutex.Unlock()
+				backend, err := updates.connect(logger, config, domain)
+				if err != nil {
+					return nil, false, err
 				}
+				provider := backend.WithLogger(hostLogger).(dnsprovider.RecordLookup)
+				return provider.LookupRecords(domain.DomainName, hostName, recordType)
 			}
 		}
 	}
 
+	v4, v6, hostPlans := hostNeedsUpdating(hostLogger, domain.DomainName, hostName, publicV4, hostV6, config, lookup)
+
+	if dryRun || (v4 == nil && v6 == nil) {
+		return append(plans, hostPlans...), nil
+	}
+
+	updates.mutex.Lock()
+	defer updates.mutex.Unlock()
+
+	// Connect to the DNS provider when the first entry that requires updating is discovered
+	_, err = updates.connect(logger, config, domain)
+	if err == nil {
+		err = updateHost(hostLogger, updates.backend, domain, hostName, v4, v6)
+	}
+	if err != nil {
+		failUpdates(hostPlans, err)
+	}
+
+	return append(plans, hostPlans...), err
+}
+
+// failUpdates records err for all planned updates
+func failUpdates(plans []hostPlan, err error) {
+	for i := range plans {
+		if plans[i].Action == actionUpdate && plans[i].Error == "" {
+			plans[i].Error = err.Error()
+		}
+	}
+}
+
+// watchAddressChanges calls execute whenever the addresses of the given interface changed. Bursts of
+// changes, like when a PPPoE session is reestablished, are combined into a single call.
+func watchAddressChanges(logger *zap.Logger, interfaceName string, execute func()) error {
+	changes := make(chan struct{}, 1)
+	err := publicip.WatchInterfaceAddresses(logger, interfaceName, changes)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		var timer *time.Timer
+		for range changes {
+			logger.Info("Address change detected, scheduling update")
+			if timer == nil {
+				timer = time.AfterFunc(addressEventDebounce, execute)
+			} else {
+				timer.Reset(addressEventDebounce)
+			}
+		}
+	}()
+
+	return nil
 }
 
 // determinePublicIPs tries to determine the current IPv4 and IPv6 addresses. If this fails or one of the versions
@@ -232,55 +499,120 @@ func determinePublicIPs(logger *zap.Logger, config *Config, provider publicip.Lo
 	return publicV4, publicV6
 }
 
+// hostIPv6 combines the first prefixLength bits of the public IPv6 address with the interface identifier
+// given in suffix.
+func hostIPv6(publicV6 net.IP, prefixLength int, suffix string) (net.IP, error) {
+	prefix := publicV6.To16()
+	if prefix == nil || publicV6.To4() != nil {
+		return nil, errors.New("'" + publicV6.String() + "' is not a valid IPv6 address")
+	}
+
+	identifier := net.ParseIP(suffix)
+	if identifier == nil || identifier.To4() != nil {
+		return nil, errors.New("'" + suffix + "' is not a valid IPv6 interface identifier")
+	}
+
+	mask := net.CIDRMask(prefixLength, 8*net.IPv6len)
+	if mask == nil {
+		return nil, fmt.Errorf("%d is not a valid IPv6 prefix length", prefixLength)
+	}
+
+	ip := make(net.IP, net.IPv6len)
+	for i := range ip {
+		ip[i] = prefix[i]&mask[i] | identifier[i]&^mask[i]
+	}
+
+	return ip, nil
+}
+
+// UnmarshalYAML allows hosts to be specified either as plain strings or as mappings
+func (h *HostConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		h.Name = name
+		return nil
+	}
+
+	type plainHostConfig HostConfig
+	return unmarshal((*plainHostConfig)(h))
+}
+
 // hostNeedsUpdating determines if the records for the given host need updating by comparing the provided IPs with
-// a DNS lookup. nil is returned for IP address types that don't need updating.
-func hostNeedsUpdating(logger *zap.Logger, domain string, hostName string, publicV4 net.IP, publicV6 net.IP, config *Config) (net.IP, net.IP) {
-	sugaredLogger := logger.Sugar()
+// a DNS lookup. nil is returned for IP address types that don't need updating. The returned plan entries describe
+// the outcome of the comparison.
+func hostNeedsUpdating(logger *zap.Logger, domain string, hostName string, publicV4 net.IP, publicV6 net.IP, config *Config, lookup recordLookup) (net.IP, net.IP, []hostPlan) {
+	plans := []hostPlan{}
 	if publicV4 != nil {
-		sugaredLogger.Info("Resolving current IPv4...")
-		currentV4, err := performDNSLookup(logger, hostName+"."+domain, config.DNSServer, dns.TypeA)
-		if err != nil {
-			sugaredLogger.Warn("Failed to resolve the current IPv4: ", err)
-		}
-		if currentV4 != nil {
-			sugaredLogger.Info("Received current IPv4 " + currentV4.String())
+		plan := checkRecord(logger, domain, recordFQDN(hostName, domain), familyIPv4, publicV4, config, lookup)
+		if plan.Action != actionUpdate {
+			publicV4 = nil
 		}
+		plans = append(plans, plan)
+	}
 
-		if currentV4 != nil && publicV4 != nil && currentV4.Equal(publicV4) {
-			if !config.ForceUpdate {
-				sugaredLogger.Info("v4 DNS entry already up to date - nothing to do.")
-				publicV4 = nil
-			} else {
-				sugaredLogger.Info("v4 DNS entry already up to date, but update forced...")
-			}
-		} else {
-			sugaredLogger.Info("v4 IPs differ - update required...")
+	if publicV6 != nil {
+		plan := checkRecord(logger, domain, recordFQDN(hostName, domain), familyIPv6, publicV6, config, lookup)
+		if plan.Action != actionUpdate {
+			publicV6 = nil
 		}
+		plans = append(plans, plan)
 	}
 
-	if publicV6 != nil {
-		sugaredLogger.Info("Resolving current IPv6...")
-		currentV6, err := performDNSLookup(logger, hostName+"."+domain, config.DNSServer, dns.TypeAAAA)
+	return publicV4, publicV6, plans
+}
+
+// recordLookup returns the contents of the host's records of the given type from the DNS provider and
+// whether they are proxied
+type recordLookup func(recordType string) ([]string, bool, error)
+
+// checkRecord compares the address currently served for fqdn with the public one. If lookup is given, the
+// current address is read from the DNS provider instead of resolving it.
+func checkRecord(logger *zap.Logger, domain string, fqdn string, family string, public net.IP, config *Config, lookup recordLookup) hostPlan {
+	sugaredLogger := logger.Sugar()
+	plan := hostPlan{Host: fqdn, Family: family, Detected: public.String(), Current: []string{}, Action: actionUpdate, domain: domain}
+
+	dnsType := dns.TypeA
+	if family == familyIPv6 {
+		dnsType = dns.TypeAAAA
+	}
+
+	var current []string
+	var err error
+	if lookup != nil {
+		sugaredLogger.Infof("Reading current %s from the DNS provider...", family)
+		current, plan.proxied, err = lookup(dns.TypeToString[dnsType])
 		if err != nil {
-			sugaredLogger.Warn("Failed to resolve the current IPv6: ", err)
+			sugaredLogger.Warnf("Failed to read the current %s: %s", family, err)
+			plan.Error = "could not read the current address: " + err.Error()
+			return plan
 		}
-		if currentV6 != nil {
-			sugaredLogger.Info("Received current IPv6 " + currentV6.String())
+	} else {
+		sugaredLogger.Infof("Resolving current %s...", family)
+		current, err = queryRecords(config.DNSServer, fqdn, dnsType)
+		if err != nil {
+			sugaredLogger.Warnf("Failed to resolve the current %s: %s", family, err)
+			plan.Error = "could not resolve the current address: " + err.Error()
+			return plan
 		}
+	}
+	plan.Current = current
+	if len(current) > 0 {
+		sugaredLogger.Infof("Received current %s %s", family, strings.Join(current, ", "))
+	}
 
-		if currentV6 != nil && publicV6 != nil && currentV6.Equal(publicV6) {
-			if !config.ForceUpdate {
-				sugaredLogger.Info("v6 DNS entry already up to date - nothing to do.")
-				publicV6 = nil
-			} else {
-				sugaredLogger.Info("v6 DNS entry already up to date, but update forced...")
-			}
+	// Additional stale records count as difference, the update replaces them
+	if len(current) == 1 && current[0] == plan.Detected {
+		if !config.ForceUpdate {
+			sugaredLogger.Infof("%s DNS entry already up to date - nothing to do.", family)
+			plan.Action = actionNone
 		} else {
-			sugaredLogger.Info("v6 IPs differ - update required...")
+			sugaredLogger.Infof("%s DNS entry already up to date, but update forced...", family)
 		}
+	} else {
+		sugaredLogger.Infof("%s IPs differ - update required...", family)
 	}
 
-	return publicV4, publicV6
+	return plan
 }
 
 func loadConfig(filename string, config *Config) error {
@@ -294,9 +626,38 @@ func loadConfig(filename string, config *Config) error {
 		return err
 	}
 
+	if config.IPv6PrefixLength == 0 {
+		config.IPv6PrefixLength = defaultIPv6PrefixLength
+	}
+	if config.PropagationTimeout == 0 {
+		config.PropagationTimeout = defaultPropagationTimeout
+	}
+	if config.PropagationInterval == 0 {
+		config.PropagationInterval = defaultPropagationInterval
+	}
+	if config.ParallelHosts == 0 {
+		config.ParallelHosts = defaultParallelHosts
+	}
+	if config.StateDirectory == "" {
+		config.StateDirectory = defaultStateDirectory()
+	}
+
 	return nil
 }
 
+// defaultStateDirectory returns the directory systemd provides with StateDirectory= or the user's cache
+// directory. An empty string is returned if neither is available.
+func defaultStateDirectory() string {
+	if directory := os.Getenv("STATE_DIRECTORY"); directory != "" {
+		// Several directories are separated by colons
+		return strings.SplitN(directory, ":", 2)[0]
+	}
+	if directory, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(directory, "hover-ddns")
+	}
+	return ""
+}
+
 func validateConfig(logger *zap.Logger, config *Config) bool {
 	if config.DNSServer == "" {
 		logger.Error("Invalid config: A DNS server must be provided")
@@ -318,15 +679,45 @@ func validateConfig(logger *zap.Logger, config *Config) bool {
 			logger.Error("Invalid config: At least one host name must be provided")
 			return false
 		}
+
+		if err := validateProviderConfig(config, &d); err != nil {
+			logger.Error("Invalid config: Provider of " + d.DomainName + ": " + err.Error())
+			return false
+		}
+
+		for _, h := range d.Hosts {
+			if h.Name == "" {
+				logger.Error("Invalid config: A host name must be provided")
+				return false
+			}
+
+			if err := validateHostName(h.Name, d.DomainName); err != nil {
+				logger.Error("Invalid config: " + err.Error())
+				return false
+			}
+
+			if h.IPv6Suffix != "" {
+				suffix := net.ParseIP(h.IPv6Suffix)
+				if suffix == nil || suffix.To4() != nil {
+					logger.Error("Invalid config: '" + h.IPv6Suffix + "' is not a valid IPv6 interface identifier")
+					return false
+				}
+			}
+		}
+	}
+
+	if config.ParallelHosts < 1 {
+		logger.Error("Invalid config: The number of parallel hosts must be at least 1")
+		return false
 	}
 
-	if config.Password == "" {
-		logger.Error("Invalid config: A password must be provided")
+	if config.IPv6PrefixLength < 0 || config.IPv6PrefixLength > 128 {
+		logger.Error("Invalid config: The IPv6 prefix length must be between 0 and 128")
 		return false
 	}
 
-	if config.Username == "" {
-		logger.Error("Invalid config: A user name must be provided")
+	if config.DynDNS2Server.ListenAddress != "" && (config.DynDNS2Server.Username == "" || config.DynDNS2Server.Password == "") {
+		logger.Error("Invalid config: The dyndns2 server requires a user name and password")
 		return false
 	}
 
@@ -343,37 +734,43 @@ func validateConfig(logger *zap.Logger, config *Config) bool {
 	return true
 }
 
-func performDNSLookup(logger *zap.Logger, hostname string, dnsServer string, dnsType uint16) (net.IP, error) {
-	client := dns.Client{}
-	message := dns.Msg{}
-	message.SetQuestion(hostname+".", dnsType)
-
-	res, _, err := client.Exchange(&message, dnsServer)
-	if res == nil {
-		return nil, err
-	}
-
-	if res.Rcode != dns.RcodeSuccess {
-		return nil, errors.New("invalid DNS answer")
+// recordFQDN returns the fully qualified name of a record. The zone apex is referred to as '@' and
+// wildcard records as '*' or '*.sub'.
+func recordFQDN(hostName string, domain string) string {
+	if hostName == "@" {
+		return domain
 	}
+	return hostName + "." + domain
+}
 
-	if len(res.Answer) == 0 {
-		return nil, errors.New("didn't get any results for the query")
+// validateHostName checks that hostName is either '@' for the zone apex or a relative name made of
+// valid labels. A wildcard '*' is only allowed as the complete leftmost label.
+func validateHostName(hostName string, domain string) error {
+	if hostName == "@" {
+		return nil
 	}
 
-	if len(res.Answer) > 1 {
-		logger.Warn("Received more than one IPs - just returning the first one")
+	if len(recordFQDN(hostName, domain)) > 253 {
+		return errors.New("host name '" + hostName + "' is too long")
 	}
 
-	record := res.Answer[0]
-	switch dnsType {
-	case dns.TypeA:
-		aRecord := record.(*dns.A)
-		return aRecord.A, nil
-	case dns.TypeAAAA:
-		aRecord := record.(*dns.AAAA)
-		return aRecord.AAAA, nil
+	labels := strings.Split(hostName, ".")
+	for i, label := range labels {
+		if label == "*" && i == 0 {
+			continue
+		}
+		if len(label) == 0 || len(label) > 63 {
+			return errors.New("host name '" + hostName + "' contains an empty or too long label")
+		}
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return errors.New("label '" + label + "' of host name '" + hostName + "' must not start or end with a hyphen")
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return errors.New("label '" + label + "' of host name '" + hostName + "' contains invalid characters")
+			}
+		}
 	}
 
-	return nil, errors.New("no valid record type selected")
+	return nil
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestValidateHostName(t *testing.T) {
+	tests := []struct {
+		hostName string
+		err      string
+	}{
+		{"@", ""},
+		{"www", ""},
+		{"home.office", ""},
+		{"*", ""},
+		{"*.lan", ""},
+		{"_acme-challenge", ""},
+		{"www.*", "contains invalid characters"},
+		{"home..office", "contains an empty or too long label"},
+		{strings.Repeat("a", 64), "contains an empty or too long label"},
+		{strings.Repeat("a.", 126) + "a", "is too long"},
+		{"-home", "must not start or end with a hyphen"},
+		{"home-", "must not start or end with a hyphen"},
+		{"home office", "contains invalid characters"},
+		{"home.example.com.", "contains an empty or too long label"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.hostName, func(t *testing.T) {
+			err := validateHostName(test.hostName, "example.com")
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("expected '%s' to be valid, got %v", test.hostName, err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("expected error containing '%s', got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestHostIPv6(t *testing.T) {
+	tests := []struct {
+		name         string
+		publicV6     string
+		prefixLength int
+		suffix       string
+		expected     string
+		err          string
+	}{
+		{"prefix 64", "2001:db8:1:2:aaaa:bbbb:cccc:dddd", 64, "::1:2:3:4", "2001:db8:1:2:1:2:3:4", ""},
+		{"prefix 56", "2001:db8:1:2ff::1", 56, "::10:0:0:0:5", "2001:db8:1:210::5", ""},
+		{"prefix 128", "2001:db8::1", 128, "::5", "2001:db8::1", ""},
+		{"suffix bits inside the prefix are ignored", "2001:db8::1", 64, "ffff::5", "2001:db8::5", ""},
+		{"ipv4 address", "198.51.100.1", 64, "::5", "", "is not a valid IPv6 address"},
+		{"ipv4 suffix", "2001:db8::1", 64, "0.0.0.5", "", "is not a valid IPv6 interface identifier"},
+		{"invalid suffix", "2001:db8::1", 64, "host", "", "is not a valid IPv6 interface identifier"},
+		{"invalid prefix length", "2001:db8::1", 129, "::5", "", "is not a valid IPv6 prefix length"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ip, err := hostIPv6(net.ParseIP(test.publicV6), test.prefixLength, test.suffix)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ip.Equal(net.ParseIP(test.expected)) {
+				t.Errorf("got %s, want %s", ip, test.expected)
+			}
+		})
+	}
+}
@@ -6,9 +6,9 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
-	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -42,10 +42,14 @@ type RecordDomain struct {
 }
 
 type Record struct {
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	Type    string `json:"type"`
-	Content string `json:"content"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Content   string `json:"content"`
+	TTL       int    `json:"ttl"`
+	Priority  int    `json:"priority,omitempty"`
+	IsDefault bool   `json:"is_default"`
+	CanRevert bool   `json:"can_revert"`
 }
 
 type CreateRecord struct {
@@ -85,6 +89,13 @@ func NewClient(logger *zap.Logger) *HoverClient {
 	return &client
 }
 
+// WithLogger returns a client that logs to logger and uses the session established so far
+func (c *HoverClient) WithLogger(logger *zap.Logger) *HoverClient {
+	client := *c
+	client.logger = logger.Sugar()
+	return &client
+}
+
 func (c *HoverClient) IsAuthenticated() bool {
 	if c == nil {
 		return false
@@ -96,54 +107,112 @@ func (c *HoverClient) IsAuthenticated() bool {
 	return true
 }
 
-// Update tries to update the DNS record for hostName with the provided IP(s).
-// Provide nil for any of the addresses if that record shouldn't get updated
-func (c *HoverClient) Update(domainName string, hostName string, ip4 net.IP, ip6 net.IP) error {
+// AddRecord creates an additional record for hostName without touching existing records
+func (c *HoverClient) AddRecord(domainName string, hostName string, recordType string, content string, ttl int) error {
 	if !c.IsAuthenticated() {
 		return errors.New("no auth session was provided")
 	}
 
 	domainID, err := c.getDomainID(domainName)
 	if err != nil {
-		c.logger.Errorf("Failed to get domain ID: %s", err)
 		return err
 	}
-	c.logger.Infof("Found domain ID %s for domain %s", domainID, domainName)
 
-	if ip4 != nil {
-		if ip4.To4() == nil {
-			c.logger.Errorf("Not updating invalid address '%s'", ip4.String())
-		} else {
-			err = c.updateSingleRecord(domainID, hostName, ip4.String(), "A")
-			if err != nil {
-				c.logger.Errorf("Was not able to update IPv4 record: %s", err)
-			}
-		}
+	c.logger.Infof("Creating new record of type '%s' and content '%s'...", recordType, content)
+	return c.createRecord(domainID, hostName, content, recordType, ttl)
+}
+
+// SetRecord replaces the records of hostName with the given type by a single record with content
+func (c *HoverClient) SetRecord(domainName string, hostName string, recordType string, content string, ttl int) error {
+	if !c.IsAuthenticated() {
+		return errors.New("no auth session was provided")
+	}
+
+	domainID, err := c.getDomainID(domainName)
+	if err != nil {
+		return err
+	}
+
+	return c.updateSingleRecord(domainID, hostName, content, recordType, ttl)
+}
+
+// Records returns all records of the given domain
+func (c *HoverClient) Records(domainName string) ([]Record, error) {
+	if !c.IsAuthenticated() {
+		return nil, errors.New("no auth session was provided")
+	}
+
+	domainID, err := c.getDomainID(domainName)
+	if err != nil {
+		return nil, err
 	}
-	if ip6 != nil {
-		if ip6.To16() == nil {
-			c.logger.Errorf("Not updating invalid address '%s'", ip4.String())
-		} else {
-			err = c.updateSingleRecord(domainID, hostName, ip6.String(), "AAAA")
-			if err != nil {
-				c.logger.Errorf("Was not able to update IPv6 record: %s", err)
-			}
+
+	return c.getRecords(domainID)
+}
+
+// RemoveRecords deletes all records of hostName with the given type. If content is not empty, only
+// records with that content are deleted.
+func (c *HoverClient) RemoveRecords(domainName string, hostName string, recordType string, content string) error {
+	if !c.IsAuthenticated() {
+		return errors.New("no auth session was provided")
+	}
+
+	domainID, err := c.getDomainID(domainName)
+	if err != nil {
+		return err
+	}
+
+	records, err := c.getRecords(domainID)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if normalizeRecordName(record.Name) != normalizeRecordName(hostName) || record.Type != recordType {
+			continue
+		}
+		if content != "" && strings.Trim(record.Content, `"`) != strings.Trim(content, `"`) {
+			continue
+		}
+		c.logger.Infof("Deleting record %s of type '%s' and content '%s'...", record.ID, recordType, record.Content)
+		err = c.deleteRecord(record.ID)
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (c *HoverClient) updateSingleRecord(domainID string, hostName string, ip string, recordType string) error {
-	recordID, err := c.getRecordID(domainID, hostName, recordType)
+// DeleteRecord deletes the record with the given ID
+func (c *HoverClient) DeleteRecord(recordID string) error {
+	if !c.IsAuthenticated() {
+		return errors.New("no auth session was provided")
+	}
+
+	c.logger.Infof("Deleting record %s...", recordID)
+	return c.deleteRecord(recordID)
+}
+
+// Domains returns all domains of the account
+func (c *HoverClient) Domains() ([]Domain, error) {
+	if !c.IsAuthenticated() {
+		return nil, errors.New("no auth session was provided")
+	}
+
+	return c.getDomains()
+}
+
+func (c *HoverClient) updateSingleRecord(domainID string, hostName string, ip string, recordType string, ttl int) error {
+	recordIDs, err := c.getRecordIDs(domainID, hostName, recordType)
 	if err != nil {
-		c.logger.Errorf("Error getting record ID: %s", err)
+		c.logger.Errorf("Error getting record IDs: %s", err)
 		return err
 	}
 
-	// Record exists, so we need to delete it before creating a new one
-	if !(recordID == "") {
-		c.logger.Infof("Found existing record ID %s for host name %s and type %s", domainID, hostName, recordType)
+	// Hover can't modify records, so all existing ones are deleted before the new one is created
+	for _, recordID := range recordIDs {
+		c.logger.Infof("Found existing record ID %s for host name %s and type %s", recordID, hostName, recordType)
 		c.logger.Info("Deleting existing record...")
 		err = c.deleteRecord(recordID)
 		if err != nil {
@@ -154,7 +223,7 @@ func (c *HoverClient) updateSingleRecord(domainID string, hostName string, ip st
 
 	// Create new record
 	c.logger.Infof("Creating new record of type '%s' and IP '%s'...", recordType, ip)
-	err = c.createRecord(domainID, hostName, ip, recordType)
+	err = c.createRecord(domainID, hostName, ip, recordType, ttl)
 	if err != nil {
 		c.logger.Errorf("Was not able to create new record: %s ", err)
 		return err
@@ -233,23 +302,43 @@ func (c *HoverClient) Login(username string, password string) error {
 }
 
 func (c *HoverClient) getDomainID(domainName string) (string, error) {
-	req, err := http.NewRequest(http.MethodGet, HoverDomainsUrl, nil)
+	domains, err := c.getDomains()
 	if err != nil {
 		return "", err
 	}
 
+	domainID := ""
+	for _, domain := range domains {
+		if domain.DomainName == domainName {
+			domainID = domain.ID
+		}
+	}
+
+	if domainID == "" {
+		return "", errors.New("Could not find domain '" + domainName + "' in list of domains")
+	}
+
+	return domainID, nil
+}
+
+func (c *HoverClient) getDomains() ([]Domain, error) {
+	req, err := http.NewRequest(http.MethodGet, HoverDomainsUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	req.AddCookie(c.sessionCookie)
 	req.AddCookie(c.authCookie)
 
 	resp, err := c.httpClient.Do(req)
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
 		io.Copy(ioutil.Discard, resp.Body)
 		resp.Body.Close()
-		return "", errors.New("Received status code " + strconv.Itoa(resp.StatusCode))
+		return nil, errors.New("Received status code " + strconv.Itoa(resp.StatusCode))
 	}
 
 	defer resp.Body.Close()
@@ -261,31 +350,38 @@ func (c *HoverClient) getDomainID(domainName string) (string, error) {
 	err = json.Unmarshal(domainsBodyBytes, &result)
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if !result.Succeeded {
-		return "", errors.New("Domain request failed")
+		return nil, errors.New("Domain request failed")
 	}
 
-	domainID := ""
-	for _, domain := range result.Domains {
-		if domain.DomainName == domainName {
-			domainID = domain.ID
-		}
+	return result.Domains, nil
+}
+
+// getRecordIDs returns the IDs of all records of hostName with the given type
+func (c *HoverClient) getRecordIDs(domainID string, hostName string, recordType string) ([]string, error) {
+	records, err := c.getRecords(domainID)
+	if err != nil {
+		return nil, err
 	}
 
-	if domainID == "" {
-		return "", errors.New("Could not find domain '" + domainName + "' in list of domains")
+	recordIDs := []string{}
+	for _, record := range records {
+		c.logger.Debugf("Record: %s %s %s", record.Name, record.Type, record.Content)
+		if normalizeRecordName(record.Name) == normalizeRecordName(hostName) && record.Type == recordType {
+			recordIDs = append(recordIDs, record.ID)
+		}
 	}
 
-	return domainID, nil
+	return recordIDs, nil
 }
 
-func (c *HoverClient) getRecordID(domainID string, hostName string, recordType string) (string, error) {
+func (c *HoverClient) getRecords(domainID string) ([]Record, error) {
 	recordsURL := HoverDomainsUrl + domainID + "/dns"
 	req, err := http.NewRequest(http.MethodGet, recordsURL, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	req.AddCookie(c.sessionCookie)
@@ -293,13 +389,13 @@ func (c *HoverClient) getRecordID(domainID string, hostName string, recordType s
 
 	recordResp, err := c.httpClient.Do(req)
 
+	if err != nil {
+		return nil, err
+	}
 	if recordResp.StatusCode != http.StatusOK {
 		io.Copy(ioutil.Discard, recordResp.Body)
 		recordResp.Body.Close()
-		return "", errors.New("Received status code " + strconv.Itoa(recordResp.StatusCode))
-	}
-	if err != nil {
-		return "", err
+		return nil, errors.New("Received status code " + strconv.Itoa(recordResp.StatusCode))
 	}
 
 	defer recordResp.Body.Close()
@@ -311,30 +407,32 @@ func (c *HoverClient) getRecordID(domainID string, hostName string, recordType s
 	err = json.Unmarshal(bodyBytes, &recordsResult)
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	c.logger.Debugf("%+v\n", recordsResult)
 	if !recordsResult.Succeeded || len(recordsResult.Domains) != 1 {
-		return "", errors.New("records request failed")
+		return nil, errors.New("records request failed")
 	}
 
-	recordID := ""
-	for _, record := range recordsResult.Domains[0].Records {
-		c.logger.Debugf("Record: %s %s %s", record.Name, record.Type, record.Content)
-		if record.Name == hostName && record.Type == recordType {
-			recordID = record.ID
-		}
-	}
+	return recordsResult.Domains[0].Records, nil
+}
 
-	return recordID, nil
+// normalizeRecordName maps the different spellings of a record name to a common form. Record names are
+// case insensitive and the zone apex may be represented as '@' or an empty name.
+func normalizeRecordName(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" {
+		return "@"
+	}
+	return name
 }
 
-func (c *HoverClient) createRecord(domainID string, hostName string, address string, recordType string) error {
+func (c *HoverClient) createRecord(domainID string, hostName string, content string, recordType string, ttl int) error {
 	r := CreateRecord{
-		Content: address,
+		Content: content,
 		Name:    hostName,
-		TTL:     RecordTTL,
+		TTL:     ttl,
 		Type:    recordType,
 	}
 
@@ -0,0 +1,109 @@
+package hover
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dschanoeh/hover-ddns/dnsprovider"
+	"go.uber.org/zap"
+)
+
+// Provider makes Hover available as dnsprovider.Provider
+type Provider struct {
+	client   *HoverClient
+	username string
+	password string
+}
+
+func NewProvider(logger *zap.Logger, username string, password string) *Provider {
+	return &Provider{
+		client:   NewClient(logger),
+		username: username,
+		password: password,
+	}
+}
+
+func (p *Provider) WithLogger(logger *zap.Logger) dnsprovider.Provider {
+	return &Provider{
+		client:   p.client.WithLogger(logger),
+		username: p.username,
+		password: p.password,
+	}
+}
+
+func (p *Provider) Authenticate() error {
+	return p.client.Login(p.username, p.password)
+}
+
+// Domains returns the names of all domains of the account
+func (p *Provider) Domains() ([]string, error) {
+	domains, err := p.client.Domains()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, domain := range domains {
+		names = append(names, domain.DomainName)
+	}
+	return names, nil
+}
+
+// Records returns all records of the given domain. Hover returns the priority of MX records separately,
+// it is prepended to the content.
+func (p *Provider) Records(domain string) ([]dnsprovider.Record, error) {
+	records, err := p.client.Records(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []dnsprovider.Record{}
+	for _, record := range records {
+		result = append(result, dnsprovider.Record{
+			ID:      record.ID,
+			Name:    normalizeRecordName(record.Name),
+			Type:    record.Type,
+			Content: recordContent(record),
+			TTL:     record.TTL,
+		})
+	}
+	return result, nil
+}
+
+func (p *Provider) UpsertRecord(domain string, name string, recordType string, content string, ttl int) error {
+	return p.client.SetRecord(domain, name, recordType, content, ttl)
+}
+
+func (p *Provider) AddRecord(domain string, name string, recordType string, content string, ttl int) error {
+	return p.client.AddRecord(domain, name, recordType, content, ttl)
+}
+
+func (p *Provider) DeleteRecords(domain string, name string, recordType string) error {
+	return p.client.RemoveRecords(domain, name, recordType, "")
+}
+
+func (p *Provider) DeleteRecord(domain string, name string, recordType string, content string) error {
+	records, err := p.Records(domain)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if record.Name != normalizeRecordName(name) || record.Type != recordType ||
+			strings.Trim(record.Content, `"`) != strings.Trim(content, `"`) {
+			continue
+		}
+		err = p.client.DeleteRecord(record.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func recordContent(record Record) string {
+	if record.Type == "MX" && record.Priority != 0 && len(strings.Fields(record.Content)) == 1 {
+		return strconv.Itoa(record.Priority) + " " + record.Content
+	}
+	return record.Content
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// nameserver is an authoritative nameserver with its addresses in host:port form, IPv4 before IPv6
+type nameserver struct {
+	name      string
+	addresses []string
+}
+
+// authoritativeNameservers looks up the NS records of zone through dnsServer and resolves the addresses
+// of the nameservers. If zone has no NS records, e.g. because it is a subdomain at a DDNS service, the
+// parent domains are tried.
+func authoritativeNameservers(zone string, dnsServer string) ([]nameserver, error) {
+	var names []string
+	for name := zone; strings.Contains(name, "."); name = name[strings.Index(name, ".")+1:] {
+		var err error
+		names, err = queryRecords(dnsServer, name, dns.TypeNS)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) > 0 {
+			break
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no nameservers found for zone '" + zone + "'")
+	}
+
+	servers := []nameserver{}
+	for _, name := range names {
+		server := nameserver{name: name}
+		for _, dnsType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			addresses, err := queryRecords(dnsServer, name, dnsType)
+			if err != nil {
+				continue
+			}
+			for _, address := range addresses {
+				server.addresses = append(server.addresses, net.JoinHostPort(address, "53"))
+			}
+		}
+		if len(server.addresses) > 0 {
+			servers = append(servers, server)
+		}
+	}
+	if len(servers) == 0 {
+		return nil, errors.New("could not resolve any nameserver of zone '" + zone + "'")
+	}
+
+	return servers, nil
+}
+
+// queryNameserver queries the addresses of server one after another until one of them answers, so
+// that nameservers are also reached over IPv6 if IPv4 isn't available
+func queryNameserver(server nameserver, name string, dnsType uint16) ([]string, error) {
+	var err error
+	for _, address := range server.addresses {
+		var values []string
+		values, err = queryRecords(address, name, dnsType)
+		if err == nil {
+			return values, nil
+		}
+	}
+	return nil, err
+}
+
+// queryRecords queries server for records of the given name and type. A and AAAA records are returned
+// as addresses, NS records as host names and TXT records with their strings concatenated.
+func queryRecords(server string, name string, dnsType uint16) ([]string, error) {
+	client := dns.Client{}
+	message := dns.Msg{}
+	message.SetQuestion(dns.Fqdn(name), dnsType)
+
+	res, _, err := client.Exchange(&message, server)
+	if res == nil {
+		return nil, err
+	}
+	if res.Rcode != dns.RcodeSuccess && res.Rcode != dns.RcodeNameError {
+		return nil, errors.New("invalid DNS answer")
+	}
+
+	values := []string{}
+	for _, record := range res.Answer {
+		switch r := record.(type) {
+		case *dns.A:
+			if dnsType == dns.TypeA {
+				values = append(values, r.A.String())
+			}
+		case *dns.AAAA:
+			if dnsType == dns.TypeAAAA {
+				values = append(values, r.AAAA.String())
+			}
+		case *dns.NS:
+			values = append(values, r.Ns)
+		case *dns.TXT:
+			values = append(values, strings.Join(r.Txt, ""))
+		}
+	}
+
+	return values, nil
+}
+
+// waitForRecord polls all authoritative nameservers of zone until each of them serves value for the
+// given name and type, the timeout has passed or ctx is done
+func waitForRecord(ctx context.Context, logger *zap.Logger, zone string, name string, dnsType uint16, value string, dnsServer string, timeout time.Duration, interval time.Duration) error {
+	sugaredLogger := logger.Sugar()
+
+	servers, err := authoritativeNameservers(zone, dnsServer)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		pending := []string{}
+		for _, server := range servers {
+			values, err := queryNameserver(server, name, dnsType)
+			if err != nil {
+				sugaredLogger.Debugf("Query of %s at %s failed: %s", name, server.name, err)
+			}
+			if !containsValue(values, value) {
+				pending = append(pending, server.name)
+			}
+		}
+
+		if len(pending) == 0 {
+			sugaredLogger.Infof("All nameservers of %s serve the new %s record of %s", zone, dns.TypeToString[dnsType], name)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.New("record not served by " + strings.Join(pending, ", ") + " after " + timeout.String())
+		}
+
+		sugaredLogger.Infof("Waiting for %d nameserver(s) to serve the new %s record of %s...", len(pending), dns.TypeToString[dnsType], name)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyPropagation waits until the authoritative nameservers serve the addresses of all successful
+// updates and records the outcome in the plans. All updates share the configured timeout, cancelling ctx
+// stops the verification.
+func verifyPropagation(ctx context.Context, logger *zap.Logger, config *Config, plans []hostPlan) {
+	sugaredLogger := logger.Sugar()
+	deadline := time.Now().Add(config.PropagationTimeout)
+
+	for i := range plans {
+		plan := &plans[i]
+		if plan.Action != actionUpdate || plan.Error != "" {
+			continue
+		}
+
+		dnsType := dns.TypeA
+		if plan.Family == familyIPv6 {
+			dnsType = dns.TypeAAAA
+		}
+		if plan.proxied {
+			sugaredLogger.Infof("%s record of %s is proxied, not verifying propagation", dns.TypeToString[dnsType], plan.Host)
+			continue
+		}
+
+		timeout := time.Until(deadline)
+		if timeout < 0 {
+			timeout = 0
+		}
+		err := waitForRecord(ctx, logger, plan.domain, plan.Host, dnsType, plan.Detected, config.DNSServer, timeout, config.PropagationInterval)
+		if ctx.Err() != nil {
+			sugaredLogger.Infof("Verification of the %s record of %s cancelled", dns.TypeToString[dnsType], plan.Host)
+			return
+		}
+		if err != nil {
+			sugaredLogger.Warnf("%s record of %s not propagated: %s", dns.TypeToString[dnsType], plan.Host, err)
+			plan.Propagation = notPropagated
+		} else {
+			sugaredLogger.Infof("%s record of %s propagated", dns.TypeToString[dnsType], plan.Host)
+			plan.Propagation = propagated
+		}
+	}
+}
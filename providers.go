@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/dschanoeh/hover-ddns/cloudflare"
+	"github.com/dschanoeh/hover-ddns/dnsprovider"
+	"github.com/dschanoeh/hover-ddns/dyndns2"
+	"github.com/dschanoeh/hover-ddns/hover"
+	"github.com/dschanoeh/hover-ddns/rfc2136"
+	"go.uber.org/zap"
+)
+
+// ProviderConfig selects the DNS backend of a domain. Hover is used if no type is given.
+type ProviderConfig struct {
+	Type string `yaml:"type"`
+	// TTL of created and updated records in seconds
+	TTL int `yaml:"ttl"`
+	// Credentials for Hover and dyndns2. For Hover, the global username and password are used if omitted.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// RFC 2136 server and optional TSIG key
+	RFC2136Server string `yaml:"rfc2136_server"`
+	TSIGKeyName   string `yaml:"tsig_key_name"`
+	TSIGSecret    string `yaml:"tsig_secret"`
+	TSIGAlgorithm string `yaml:"tsig_algorithm"`
+	// Cloudflare API token with DNS edit permission and the proxied flag for updated records
+	CloudflareAPIToken string `yaml:"cloudflare_api_token"`
+	CloudflareProxied  *bool  `yaml:"cloudflare_proxied"`
+	// Update URL of a dyndns2 service, e.g. https://dynupdate.no-ip.com/nic/update
+	DynDNS2URL string `yaml:"dyndns2_url"`
+}
+
+var (
+	// dnsProviders keeps the backends between runs so that sessions, caches and backoff state survive.
+	// They are keyed by providerKey.
+	dnsProviders      = map[string]dnsprovider.Provider{}
+	dnsProvidersMutex sync.Mutex
+)
+
+// providerKey identifies the account behind the backend of a domain. Domains of the same Hover or dyndns2
+// account share a backend, so that they use one session and one backoff state.
+func providerKey(config *Config, domain *DomainConfig) string {
+	providerConfig := &domain.Provider
+	switch providerConfig.Type {
+	case "", "hover":
+		username, password := hoverCredentials(config, providerConfig)
+		return strings.Join([]string{"hover", username, password}, "\x00")
+	case "dyndns2":
+		return strings.Join([]string{"dyndns2", providerConfig.DynDNS2URL, providerConfig.Username, providerConfig.Password}, "\x00")
+	default:
+		return strings.Join([]string{"domain", domain.DomainName}, "\x00")
+	}
+}
+
+// newDNSProvider creates the backend of the given domain
+func newDNSProvider(logger *zap.Logger, config *Config, domain *DomainConfig) (dnsprovider.Provider, error) {
+	providerConfig := domain.Provider
+	switch providerConfig.Type {
+	case "", "hover":
+		username, password := hoverCredentials(config, &providerConfig)
+		return hover.NewProvider(logger, username, password), nil
+	case "rfc2136":
+		client, err := rfc2136.NewClient(logger, providerConfig.RFC2136Server, providerConfig.TSIGKeyName,
+			providerConfig.TSIGSecret, providerConfig.TSIGAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case "cloudflare":
+		if providerConfig.CloudflareAPIToken == "" {
+			return nil, errors.New("a Cloudflare API token must be provided")
+		}
+		return cloudflare.NewClient(logger, providerConfig.CloudflareAPIToken, providerConfig.CloudflareProxied), nil
+	case "dyndns2":
+		client, err := dyndns2.NewClient(logger, providerConfig.DynDNS2URL, providerConfig.Username, providerConfig.Password,
+			config.StateDirectory)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	default:
+		return nil, errors.New("'" + providerConfig.Type + "' is not a valid DNS provider")
+	}
+}
+
+// cachedDNSProvider returns the backend of the given domain without authenticating it. The backend is
+// created on first use and reused afterwards.
+func cachedDNSProvider(logger *zap.Logger, config *Config, domain *DomainConfig) (dnsprovider.Provider, error) {
+	dnsProvidersMutex.Lock()
+	defer dnsProvidersMutex.Unlock()
+
+	key := providerKey(config, domain)
+	backend, ok := dnsProviders[key]
+	if !ok {
+		var err error
+		backend, err = newDNSProvider(logger, config, domain)
+		if err != nil {
+			return nil, err
+		}
+		dnsProviders[key] = backend
+	}
+	return backend, nil
+}
+
+// connectDNSProvider authenticates the backend of the given domain
+func connectDNSProvider(logger *zap.Logger, config *Config, domain *DomainConfig) (dnsprovider.Provider, error) {
+	backend, err := cachedDNSProvider(logger, config, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	err = backend.Authenticate()
+	if err != nil {
+		return nil, err
+	}
+	return backend, nil
+}
+
+// updateHost points the A and AAAA records of hostName to the given addresses. Provide nil for any of the
+// addresses if that record shouldn't get updated. Both records are attempted even if one of them fails,
+// the last error is returned.
+func updateHost(logger *zap.Logger, backend dnsprovider.Provider, domain *DomainConfig, hostName string, ip4 net.IP, ip6 net.IP) error {
+	sugaredLogger := logger.Sugar()
+	ttl := recordTTL(&domain.Provider)
+	backend = backend.WithLogger(logger)
+
+	var updateErr error
+	if ip4 != nil {
+		sugaredLogger.Infof("Updating A record of %s to %s...", recordFQDN(hostName, domain.DomainName), ip4.String())
+		err := backend.UpsertRecord(domain.DomainName, hostName, "A", ip4.String(), ttl)
+		if err != nil {
+			sugaredLogger.Errorf("Was not able to update IPv4 record: %s", err)
+			updateErr = err
+		}
+	}
+	if ip6 != nil {
+		sugaredLogger.Infof("Updating AAAA record of %s to %s...", recordFQDN(hostName, domain.DomainName), ip6.String())
+		err := backend.UpsertRecord(domain.DomainName, hostName, "AAAA", ip6.String(), ttl)
+		if err != nil {
+			sugaredLogger.Errorf("Was not able to update IPv6 record: %s", err)
+			updateErr = err
+		}
+	}
+
+	return updateErr
+}
+
+// validateProviderConfig checks that all settings required by the backend of the domain are present
+func validateProviderConfig(config *Config, domain *DomainConfig) error {
+	providerConfig := &domain.Provider
+	if providerConfig.TTL < 0 {
+		return errors.New("the TTL must not be negative")
+	}
+
+	if providerConfig.Type == "" || providerConfig.Type == "hover" {
+		username, password := hoverCredentials(config, providerConfig)
+		if password == "" {
+			return errors.New("a password must be provided")
+		}
+		if username == "" {
+			return errors.New("a user name must be provided")
+		}
+	}
+
+	_, err := newDNSProvider(zap.NewNop(), config, domain)
+	return err
+}
+
+// recordTTL returns the TTL to use for records of the given backend
+func recordTTL(providerConfig *ProviderConfig) int {
+	if providerConfig.TTL == 0 {
+		return hover.RecordTTL
+	}
+	return providerConfig.TTL
+}
+
+func hoverCredentials(config *Config, providerConfig *ProviderConfig) (string, string) {
+	if providerConfig.Username != "" || providerConfig.Password != "" {
+		return providerConfig.Username, providerConfig.Password
+	}
+	return config.Username, config.Password
+}
@@ -0,0 +1,129 @@
+package publicip
+
+import (
+	"errors"
+	"net"
+)
+
+// bogonNetworks are address ranges that must never be published as public addresses. This covers
+// private, shared (CGNAT), loopback, link-local, documentation, unique local and multicast ranges.
+var bogonNetworks = mustParseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"100::/64",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"fec0::/10",
+	"ff00::/8",
+)
+
+// AddressPolicyConfig configures which addresses returned by a lookup provider are accepted
+type AddressPolicyConfig struct {
+	// AllowBogons disables the check against private and otherwise non-routable ranges
+	AllowBogons bool `yaml:"allow_bogons"`
+	// AllowedNetworks are accepted even if they are part of a bogon range
+	AllowedNetworks []string `yaml:"allowed_networks"`
+	// DeniedNetworks are rejected in addition to the bogon ranges
+	DeniedNetworks []string `yaml:"denied_networks"`
+}
+
+// AddressPolicy checks addresses before they are published
+type AddressPolicy struct {
+	allowBogons     bool
+	allowedNetworks []*net.IPNet
+	deniedNetworks  []*net.IPNet
+}
+
+// NewAddressPolicy creates a new address policy from the given configuration
+func NewAddressPolicy(config *AddressPolicyConfig) (*AddressPolicy, error) {
+	allowedNetworks, err := parseNetworks(config.AllowedNetworks)
+	if err != nil {
+		return nil, err
+	}
+	deniedNetworks, err := parseNetworks(config.DeniedNetworks)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AddressPolicy{
+		allowBogons:     config.AllowBogons,
+		allowedNetworks: allowedNetworks,
+		deniedNetworks:  deniedNetworks,
+	}, nil
+}
+
+// Check returns an error if ip is not of the expected family or must not be published
+func (p *AddressPolicy) Check(ip net.IP, v6 bool) error {
+	if ip == nil {
+		return errors.New("no address was provided")
+	}
+	if v6 && ip.To4() != nil {
+		return errors.New("'" + ip.String() + "' is not an IPv6 address")
+	}
+	if !v6 && ip.To4() == nil {
+		return errors.New("'" + ip.String() + "' is not an IPv4 address")
+	}
+
+	if containsIP(p.deniedNetworks, ip) {
+		return errors.New("'" + ip.String() + "' is part of a denied network")
+	}
+	if containsIP(p.allowedNetworks, ip) || p.allowBogons {
+		return nil
+	}
+	if containsIP(bogonNetworks, ip) {
+		return errors.New("'" + ip.String() + "' is not a public address")
+	}
+
+	return nil
+}
+
+// policyLookupProvider refuses all results of the wrapped provider that violate the address policy
+type policyLookupProvider struct {
+	provider LookupProvider
+	policy   *AddressPolicy
+}
+
+func (p *policyLookupProvider) GetPublicIP() (net.IP, error) {
+	ip, err := p.provider.GetPublicIP()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.policy.Check(ip, false); err != nil {
+		return nil, errors.New("refusing provider result: " + err.Error())
+	}
+	return ip, nil
+}
+
+func (p *policyLookupProvider) GetPublicIPv6() (net.IP, error) {
+	ip, err := p.provider.GetPublicIPv6()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.policy.Check(ip, true); err != nil {
+		return nil, errors.New("refusing provider result: " + err.Error())
+	}
+	return ip, nil
+}
+
+func mustParseNetworks(cidrs ...string) []*net.IPNet {
+	networks, err := parseNetworks(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return networks
+}
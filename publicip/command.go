@@ -0,0 +1,118 @@
+package publicip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultCommandTimeout = 10 * time.Second
+
+// CommandLookupProvider is a public IP lookup provider that runs an external command and takes the
+// first address of the requested family from its output
+type CommandLookupProvider struct {
+	logger  *zap.SugaredLogger
+	command string
+	argsV4  []string
+	argsV6  []string
+	timeout time.Duration
+}
+
+// NewCommandLookupProvider creates a new command lookup provider
+func NewCommandLookupProvider(logger *zap.Logger, config *LookupProviderConfig) (*CommandLookupProvider, error) {
+	if config.Command == "" {
+		return nil, errors.New("for the command service, a command must be provided")
+	}
+
+	timeout := config.CommandTimeout
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+
+	return &CommandLookupProvider{
+		logger:  logger.Sugar(),
+		command: config.Command,
+		argsV4:  config.CommandArgsV4,
+		argsV6:  config.CommandArgsV6,
+		timeout: timeout,
+	}, nil
+}
+
+// GetPublicIP returns the current public IP or nil if an error occurred
+func (p *CommandLookupProvider) GetPublicIP() (net.IP, error) {
+	return p.getAddress(false)
+}
+
+func (p *CommandLookupProvider) GetPublicIPv6() (net.IP, error) {
+	return p.getAddress(true)
+}
+
+func (p *CommandLookupProvider) getAddress(v6 bool) (net.IP, error) {
+	args := p.argsV4
+	if v6 {
+		args = p.argsV6
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait for children of the command that still hold on to its output after a timeout
+	cmd.WaitDelay = time.Second
+
+	p.logger.Debugf("Running command %s %s", p.command, strings.Join(args, " "))
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, errors.New("command timed out after " + p.timeout.String())
+	}
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message != "" {
+			return nil, errors.New("command failed: " + err.Error() + ": " + message)
+		}
+		return nil, errors.New("command failed: " + err.Error())
+	}
+
+	ip := firstIP(stdout.String(), v6)
+	if ip == nil {
+		return nil, errors.New("command output didn't contain a valid IP address")
+	}
+
+	return ip, nil
+}
+
+// firstIP returns the first address of the requested family found in text
+func firstIP(text string, v6 bool) net.IP {
+	isAddressCharacter := func(r rune) bool {
+		return r == '.' || r == ':' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+	}
+	tokens := strings.FieldsFunc(text, func(r rune) bool {
+		return !isAddressCharacter(r)
+	})
+
+	for _, token := range tokens {
+		ip := net.ParseIP(token)
+		if ip == nil {
+			// Strip a trailing full stop
+			ip = net.ParseIP(strings.TrimRight(token, "."))
+		}
+		if ip == nil {
+			// Strip punctuation like a colon after a label
+			ip = net.ParseIP(strings.Trim(token, ".:"))
+		}
+		if ip != nil && (ip.To4() == nil) == v6 {
+			return ip
+		}
+	}
+
+	return nil
+}
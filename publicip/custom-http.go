@@ -0,0 +1,243 @@
+package publicip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const httpRetryDelay = 1000 * time.Millisecond
+
+// HTTPLookupProvider is a public IP lookup provider querying a configurable HTTP endpoint. The address
+// is either the whole response body or extracted from it with a regular expression or a JSON path.
+type HTTPLookupProvider struct {
+	logger       *zap.SugaredLogger
+	dialerV4     *net.Dialer
+	dialerV6     *net.Dialer
+	httpClientV4 *http.Client
+	httpClientV6 *http.Client
+	settings     httpLookupSettings
+	regex        *regexp.Regexp
+}
+
+// httpLookupSettings describe an HTTP endpoint and how the address is extracted from its response
+type httpLookupSettings struct {
+	urlV4    string
+	urlV6    string
+	headers  map[string]string
+	username string
+	password string
+	regex    string
+	jsonPath string
+	retries  int
+	binding  *sourceBinding
+}
+
+// NewHTTPLookupProvider creates a new lookup provider from the custom_http settings of the configuration
+func NewHTTPLookupProvider(logger *zap.Logger, config *LookupProviderConfig) (*HTTPLookupProvider, error) {
+	if config.HTTPURL == "" && config.HTTPURLV6 == "" {
+		return nil, errors.New("for the custom_http service, an http_url or http_url_v6 must be provided")
+	}
+	if config.HTTPRegex != "" && config.HTTPJSONPath != "" {
+		return nil, errors.New("only one of http_regex and http_json_path may be provided")
+	}
+	binding, err := newSourceBinding(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return newHTTPLookupProvider(logger, httpLookupSettings{
+		urlV4:    config.HTTPURL,
+		urlV6:    config.HTTPURLV6,
+		headers:  config.HTTPHeaders,
+		username: config.HTTPUsername,
+		password: config.HTTPPassword,
+		regex:    config.HTTPRegex,
+		jsonPath: config.HTTPJSONPath,
+		retries:  1,
+		binding:  binding,
+	})
+}
+
+func newHTTPLookupProvider(logger *zap.Logger, settings httpLookupSettings) (*HTTPLookupProvider, error) {
+	provider := HTTPLookupProvider{
+		logger:   logger.Sugar(),
+		settings: settings,
+		dialerV4: settings.binding.dialer("tcp4"),
+		dialerV6: settings.binding.dialer("tcp6"),
+	}
+
+	if settings.regex != "" {
+		regex, err := regexp.Compile(settings.regex)
+		if err != nil {
+			return nil, errors.New("'" + settings.regex + "' is not a valid regular expression: " + err.Error())
+		}
+		provider.regex = regex
+	}
+
+	transportV4 := http.DefaultTransport.(*http.Transport).Clone()
+	transportV4.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return provider.dialerV4.DialContext(ctx, "tcp4", addr)
+	}
+	provider.httpClientV4 = &http.Client{
+		Transport: transportV4,
+	}
+
+	transportV6 := http.DefaultTransport.(*http.Transport).Clone()
+	transportV6.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return provider.dialerV6.DialContext(ctx, "tcp6", addr)
+	}
+	provider.httpClientV6 = &http.Client{
+		Transport: transportV6,
+	}
+
+	return &provider, nil
+}
+
+// GetPublicIP returns the current public IP or nil if an error occurred
+func (p *HTTPLookupProvider) GetPublicIP() (net.IP, error) {
+	return p.getAddress(false)
+}
+
+func (p *HTTPLookupProvider) GetPublicIPv6() (net.IP, error) {
+	return p.getAddress(true)
+}
+
+func (p *HTTPLookupProvider) getAddress(v6 bool) (net.IP, error) {
+	var client *http.Client
+	var url string
+	if v6 {
+		client = p.httpClientV6
+		url = p.settings.urlV6
+	} else {
+		client = p.httpClientV4
+		url = p.settings.urlV4
+	}
+
+	if url == "" && v6 {
+		return nil, errors.New("provider doesn't support IPv6 yet")
+	}
+	if url == "" {
+		return nil, errors.New("provider doesn't support IPv4")
+	}
+
+	var body []byte
+	var err error
+	for i := 0; i < p.settings.retries; i++ {
+		body, err = p.fetch(client, url)
+		if err == nil {
+			break
+		}
+		if i < p.settings.retries-1 {
+			p.logger.Warn("Request failed: ", err)
+			time.Sleep(httpRetryDelay)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ipString, err := p.extract(body)
+	if err != nil {
+		return nil, err
+	}
+
+	ip := net.ParseIP(ipString)
+	if ip == nil {
+		return nil, errors.New("'" + ipString + "' is not a valid IP address.")
+	}
+
+	return ip, nil
+}
+
+func (p *HTTPLookupProvider) fetch(client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range p.settings.headers {
+		req.Header.Set(name, value)
+	}
+	if p.settings.username != "" {
+		req.SetBasicAuth(p.settings.username, p.settings.password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, errors.New("received status code " + strconv.Itoa(resp.StatusCode))
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// extract returns the address string from a response body. With a regular expression, the first
+// capturing group or otherwise the whole match is used.
+func (p *HTTPLookupProvider) extract(body []byte) (string, error) {
+	if p.regex != nil {
+		match := p.regex.FindSubmatch(body)
+		if match == nil {
+			return "", errors.New("response didn't match the regular expression")
+		}
+		if len(match) > 1 {
+			return strings.TrimSpace(string(match[1])), nil
+		}
+		return strings.TrimSpace(string(match[0])), nil
+	}
+
+	if p.settings.jsonPath != "" {
+		return extractJSONPath(body, p.settings.jsonPath)
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
+
+// extractJSONPath resolves a dot separated path like 'wan.addresses.0.ip' in a JSON document.
+// Numeric path elements index into arrays.
+func extractJSONPath(body []byte, path string) (string, error) {
+	var document interface{}
+	err := json.Unmarshal(body, &document)
+	if err != nil {
+		return "", err
+	}
+
+	current := document
+	for _, element := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, "$"), "."), ".") {
+		switch v := current.(type) {
+		case map[string]interface{}:
+			value, ok := v[element]
+			if !ok {
+				return "", errors.New("JSON path element '" + element + "' not found")
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(element)
+			if err != nil || index < 0 || index >= len(v) {
+				return "", errors.New("JSON path element '" + element + "' is not a valid array index")
+			}
+			current = v[index]
+		default:
+			return "", errors.New("JSON path element '" + element + "' can't be resolved")
+		}
+	}
+
+	value, ok := current.(string)
+	if !ok {
+		return "", errors.New("JSON path '" + path + "' doesn't point to a string")
+	}
+	return strings.TrimSpace(value), nil
+}
@@ -0,0 +1,112 @@
+package publicip
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"strings"
+)
+
+// digestCredentials answer HTTP digest authentication challenges (RFC 7616) using MD5
+type digestCredentials struct {
+	username string
+	password string
+}
+
+// authorization computes the Authorization header for the given WWW-Authenticate challenge
+func (c *digestCredentials) authorization(challenge string, method string, requestURL string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "digest ") {
+		return "", errors.New("server didn't request digest authentication")
+	}
+	parameters := parseDigestChallenge(challenge[len("digest "):])
+
+	realm := parameters["realm"]
+	nonce := parameters["nonce"]
+	if nonce == "" {
+		return "", errors.New("digest challenge didn't contain a nonce")
+	}
+	if algorithm := parameters["algorithm"]; algorithm != "" && !strings.EqualFold(algorithm, "MD5") {
+		return "", errors.New("digest algorithm '" + algorithm + "' is not supported")
+	}
+
+	parsedURL, err := neturl.Parse(requestURL)
+	if err != nil {
+		return "", err
+	}
+	uri := parsedURL.RequestURI()
+
+	ha1 := md5Hex(c.username + ":" + realm + ":" + c.password)
+	ha2 := md5Hex(method + ":" + uri)
+
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s"`, c.username, realm, nonce, uri)
+
+	if qop := parameters["qop"]; qop != "" {
+		supportsAuth := false
+		for _, q := range strings.Split(qop, ",") {
+			if strings.TrimSpace(q) == "auth" {
+				supportsAuth = true
+			}
+		}
+		if !supportsAuth {
+			return "", errors.New("digest qop '" + qop + "' is not supported")
+		}
+
+		cnonceBytes := make([]byte, 8)
+		_, err = rand.Read(cnonceBytes)
+		if err != nil {
+			return "", err
+		}
+		cnonce := hex.EncodeToString(cnonceBytes)
+		nc := "00000001"
+
+		response := md5Hex(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":auth:" + ha2)
+		header += fmt.Sprintf(`, qop=auth, nc=%s, cnonce="%s", response="%s"`, nc, cnonce, response)
+	} else {
+		header += fmt.Sprintf(`, response="%s"`, md5Hex(ha1+":"+nonce+":"+ha2))
+	}
+
+	if opaque := parameters["opaque"]; opaque != "" {
+		header += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+
+	return header, nil
+}
+
+// parseDigestChallenge splits the comma separated key=value pairs of a challenge. Commas within
+// quoted values are preserved.
+func parseDigestChallenge(challenge string) map[string]string {
+	parameters := map[string]string{}
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i, r := range challenge {
+		switch r {
+		case '"':
+			inQuotes = !inQuotes
+		case ',':
+			if !inQuotes {
+				parts = append(parts, challenge[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, challenge[start:])
+
+	for _, part := range parts {
+		keyValue := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(keyValue) != 2 {
+			continue
+		}
+		parameters[strings.ToLower(strings.TrimSpace(keyValue[0]))] = strings.Trim(strings.TrimSpace(keyValue[1]), `"`)
+	}
+
+	return parameters
+}
+
+func md5Hex(value string) string {
+	sum := md5.Sum([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,132 @@
+package publicip
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultDNSQueryName = "myip.opendns.com"
+	DefaultDNSServer    = "resolver1.opendns.com:53"
+	dnsDialTimeout      = 2 * time.Second
+)
+
+// DNSLookupProvider is a public IP lookup provider that discovers the address with special DNS queries,
+// e.g. myip.opendns.com against the OpenDNS resolvers or a TXT query for o-o.myaddr.l.google.com
+type DNSLookupProvider struct {
+	logger    *zap.SugaredLogger
+	queryName string
+	queryType uint16
+	server    string
+	binding   *sourceBinding
+}
+
+// NewDNSLookupProvider creates a new DNS lookup provider. If no query type is given, A records are queried
+// for IPv4 and AAAA records for IPv6.
+func NewDNSLookupProvider(logger *zap.Logger, config *LookupProviderConfig) (*DNSLookupProvider, error) {
+	binding, err := newSourceBinding(config)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := DNSLookupProvider{
+		logger:    logger.Sugar(),
+		queryName: config.DNSQueryName,
+		server:    config.DNSServer,
+		binding:   binding,
+	}
+	if provider.queryName == "" {
+		provider.queryName = DefaultDNSQueryName
+	}
+	if provider.server == "" {
+		provider.server = DefaultDNSServer
+	}
+	if _, _, err := net.SplitHostPort(provider.server); err != nil {
+		provider.server = net.JoinHostPort(provider.server, "53")
+	}
+
+	switch strings.ToUpper(config.DNSQueryType) {
+	case "":
+		provider.queryType = dns.TypeNone
+	case "A":
+		provider.queryType = dns.TypeA
+	case "AAAA":
+		provider.queryType = dns.TypeAAAA
+	case "TXT":
+		provider.queryType = dns.TypeTXT
+	default:
+		return nil, errors.New("'" + config.DNSQueryType + "' is not a supported DNS query type")
+	}
+
+	return &provider, nil
+}
+
+// GetPublicIP returns the current public IP or nil if an error occurred
+func (p *DNSLookupProvider) GetPublicIP() (net.IP, error) {
+	return p.getAddress(false)
+}
+
+func (p *DNSLookupProvider) GetPublicIPv6() (net.IP, error) {
+	return p.getAddress(true)
+}
+
+func (p *DNSLookupProvider) getAddress(v6 bool) (net.IP, error) {
+	// The query has to be sent via the address family we want to learn about
+	client := dns.Client{Net: "udp4"}
+	queryType := p.queryType
+	if v6 {
+		client.Net = "udp6"
+	}
+	client.Dialer = p.binding.dialer(client.Net)
+	client.Dialer.Timeout = dnsDialTimeout
+	if queryType == dns.TypeNone {
+		queryType = dns.TypeA
+		if v6 {
+			queryType = dns.TypeAAAA
+		}
+	}
+
+	message := dns.Msg{}
+	message.SetQuestion(dns.Fqdn(p.queryName), queryType)
+
+	res, _, err := client.Exchange(&message, p.server)
+	if res == nil {
+		return nil, err
+	}
+	if res.Rcode != dns.RcodeSuccess {
+		return nil, errors.New("invalid DNS answer")
+	}
+
+	candidates := []net.IP{}
+	for _, record := range res.Answer {
+		switch r := record.(type) {
+		case *dns.A:
+			candidates = append(candidates, r.A)
+		case *dns.AAAA:
+			candidates = append(candidates, r.AAAA)
+		case *dns.TXT:
+			for _, txt := range r.Txt {
+				p.logger.Debugf("Received TXT record '%s'", txt)
+				if ip := net.ParseIP(strings.TrimSpace(txt)); ip != nil {
+					candidates = append(candidates, ip)
+				}
+			}
+		}
+	}
+
+	for _, ip := range candidates {
+		if (ip.To4() == nil) == v6 {
+			return ip, nil
+		}
+	}
+	if len(candidates) > 0 {
+		return nil, errors.New("the answer only contained addresses of the other family")
+	}
+
+	return nil, errors.New("didn't get any addresses for the query")
+}
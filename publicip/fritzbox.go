@@ -0,0 +1,123 @@
+package publicip
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultFritzBoxURL      = "http://fritz.box:49000"
+	fritzBoxRequestTimeout  = 10 * time.Second
+	fritzBoxGetExternalIPv4 = "GetExternalIPAddress"
+	fritzBoxGetExternalIPv6 = "X_AVM_DE_GetExternalIPv6Address"
+)
+
+type fritzBoxService struct {
+	serviceType string
+	controlPath string
+}
+
+// fritzBoxServices are the TR-064 services that report the external address. Boxes with an IP based
+// uplink (cable, fiber, LTE) report it on WANIPConnection, PPPoE (DSL) boxes on WANPPPConnection.
+var fritzBoxServices = []fritzBoxService{
+	{"urn:dslforum-org:service:WANIPConnection:1", "/upnp/control/wanipconnection1"},
+	{"urn:dslforum-org:service:WANPPPConnection:1", "/upnp/control/wanpppconn1"},
+}
+
+type fritzBoxExternalIPv4Response struct {
+	ExternalIPAddress string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+}
+
+type fritzBoxExternalIPv6Response struct {
+	ExternalIPv6Address string `xml:"Body>X_AVM_DE_GetExternalIPv6AddressResponse>NewExternalIPv6Address"`
+	PrefixLength        string `xml:"Body>X_AVM_DE_GetExternalIPv6AddressResponse>NewPrefixLength"`
+}
+
+// FritzBoxLookupProvider is a public IP lookup provider asking an AVM FRITZ!Box via TR-064
+type FritzBoxLookupProvider struct {
+	logger      *zap.SugaredLogger
+	httpClient  *http.Client
+	baseURL     string
+	credentials *digestCredentials
+}
+
+// NewFritzBoxLookupProvider creates a new FRITZ!Box lookup provider. Credentials are optional and only
+// used if the box requests authentication.
+func NewFritzBoxLookupProvider(logger *zap.Logger, config *LookupProviderConfig) *FritzBoxLookupProvider {
+	baseURL := config.FritzBoxURL
+	if baseURL == "" {
+		baseURL = DefaultFritzBoxURL
+	}
+
+	provider := FritzBoxLookupProvider{
+		logger:     logger.Sugar(),
+		httpClient: &http.Client{Timeout: fritzBoxRequestTimeout},
+		baseURL:    strings.TrimRight(baseURL, "/"),
+	}
+	if config.FritzBoxUsername != "" || config.FritzBoxPassword != "" {
+		provider.credentials = &digestCredentials{
+			username: config.FritzBoxUsername,
+			password: config.FritzBoxPassword,
+		}
+	}
+
+	return &provider
+}
+
+// GetPublicIP returns the current public IP or nil if an error occurred
+func (p *FritzBoxLookupProvider) GetPublicIP() (net.IP, error) {
+	return p.queryAddress(fritzBoxGetExternalIPv4, func(service fritzBoxService) (string, error) {
+		response := fritzBoxExternalIPv4Response{}
+		err := soapRequest(p.httpClient, p.credentials, p.baseURL+service.controlPath, service.serviceType, fritzBoxGetExternalIPv4, &response)
+		return response.ExternalIPAddress, err
+	})
+}
+
+func (p *FritzBoxLookupProvider) GetPublicIPv6() (net.IP, error) {
+	return p.queryAddress(fritzBoxGetExternalIPv6, func(service fritzBoxService) (string, error) {
+		response := fritzBoxExternalIPv6Response{}
+		err := soapRequest(p.httpClient, p.credentials, p.baseURL+service.controlPath, service.serviceType, fritzBoxGetExternalIPv6, &response)
+		if err == nil {
+			p.logger.Debugf("FRITZ!Box reported IPv6 address %s with prefix length %s", response.ExternalIPv6Address, response.PrefixLength)
+		}
+		return response.ExternalIPv6Address, err
+	})
+}
+
+// queryAddress asks the WAN connection services in turn until one of them reports an address
+func (p *FritzBoxLookupProvider) queryAddress(action string, query func(service fritzBoxService) (string, error)) (net.IP, error) {
+	failures := []string{}
+	for _, service := range fritzBoxServices {
+		address, err := query(service)
+		if err == nil {
+			var ip net.IP
+			ip, err = parseFritzBoxAddress(address)
+			if err == nil {
+				return ip, nil
+			}
+		}
+		p.logger.Debugf("%s via %s failed: %s", action, service.serviceType, err)
+		failures = append(failures, service.serviceType+": "+err.Error())
+	}
+
+	return nil, errors.New("no WAN connection service reported an address (" + strings.Join(failures, "; ") + ")")
+}
+
+func parseFritzBoxAddress(address string) (net.IP, error) {
+	ipString := strings.TrimSpace(address)
+	if ipString == "" {
+		return nil, errors.New("FRITZ!Box didn't report an address, is the internet connection up?")
+	}
+
+	ip := net.ParseIP(ipString)
+	if ip == nil {
+		return nil, errors.New("'" + ipString + "' is not a valid IP address.")
+	}
+
+	return ip, nil
+}
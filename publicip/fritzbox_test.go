@@ -0,0 +1,206 @@
+package publicip
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+const (
+	testFritzBoxRealm    = "F!Box SOAP-Auth"
+	testFritzBoxNonce    = "3F2A9C11D4E5"
+	testFritzBoxUsername = "hover-ddns"
+	testFritzBoxPassword = "secret"
+)
+
+// fritzBoxStub emulates the TR-064 interface of a FRITZ!Box that requires digest authentication.
+// addresses maps control paths to the address reported by GetExternalIPAddress or, for IPv6,
+// X_AVM_DE_GetExternalIPv6Address. Paths that are not contained answer with a SOAP fault.
+type fritzBoxStub struct {
+	t         *testing.T
+	password  string
+	addresses map[string]string
+	requests  []string
+}
+
+func (s *fritzBoxStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.requests = append(s.requests, r.URL.Path)
+
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" || !s.validAuthorization(r.Method, authorization) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", nonce="%s", algorithm=MD5, qop="auth"`,
+			testFritzBoxRealm, testFritzBoxNonce))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	address, ok := s.addresses[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault>` +
+			`<faultstring>UPnPError</faultstring></s:Fault></s:Body></s:Envelope>`))
+		return
+	}
+
+	action := strings.Trim(r.Header.Get("SOAPAction"), `"`)
+	action = action[strings.Index(action, "#")+1:]
+	if !strings.Contains(string(body), "<u:"+action) {
+		s.t.Errorf("body doesn't contain the action %s: %s", action, body)
+	}
+
+	element := "NewExternalIPAddress"
+	if action == fritzBoxGetExternalIPv6 {
+		element = "NewExternalIPv6Address"
+	}
+	fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+		`<u:%sResponse xmlns:u="urn:dslforum-org:service:WANIPConnection:1"><%s>%s</%s><NewPrefixLength>64</NewPrefixLength>`+
+		`</u:%sResponse></s:Body></s:Envelope>`, action, element, address, element, action)
+}
+
+// validAuthorization checks the digest response the way the box does
+func (s *fritzBoxStub) validAuthorization(method string, authorization string) bool {
+	if !strings.HasPrefix(authorization, "Digest ") {
+		s.t.Errorf("unexpected authorization scheme: %s", authorization)
+		return false
+	}
+	parameters := parseDigestChallenge(authorization[len("Digest "):])
+	if parameters["username"] != testFritzBoxUsername || parameters["realm"] != testFritzBoxRealm ||
+		parameters["nonce"] != testFritzBoxNonce || parameters["qop"] != "auth" || parameters["cnonce"] == "" {
+		s.t.Errorf("unexpected authorization parameters: %v", parameters)
+		return false
+	}
+
+	ha1 := md5Hex(testFritzBoxUsername + ":" + testFritzBoxRealm + ":" + s.password)
+	ha2 := md5Hex(method + ":" + parameters["uri"])
+	expected := md5Hex(ha1 + ":" + testFritzBoxNonce + ":" + parameters["nc"] + ":" + parameters["cnonce"] + ":auth:" + ha2)
+	return parameters["response"] == expected
+}
+
+func newTestFritzBox(t *testing.T, addresses map[string]string) (*fritzBoxStub, *FritzBoxLookupProvider) {
+	t.Helper()
+	stub := &fritzBoxStub{t: t, password: testFritzBoxPassword, addresses: addresses}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	provider := NewFritzBoxLookupProvider(zap.NewNop(), &LookupProviderConfig{
+		FritzBoxURL:      server.URL + "/",
+		FritzBoxUsername: testFritzBoxUsername,
+		FritzBoxPassword: testFritzBoxPassword,
+	})
+	return stub, provider
+}
+
+func TestFritzBoxIPConnection(t *testing.T) {
+	stub, provider := newTestFritzBox(t, map[string]string{
+		"/upnp/control/wanipconnection1": "198.51.100.30",
+	})
+
+	ip, err := provider.GetPublicIP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.ParseIP("198.51.100.30")) {
+		t.Errorf("got %s, want 198.51.100.30", ip)
+	}
+	// The first request is answered with the challenge, the second one carries the response
+	if len(stub.requests) != 2 {
+		t.Errorf("expected 2 requests, got %v", stub.requests)
+	}
+}
+
+func TestFritzBoxPPPConnection(t *testing.T) {
+	stub, provider := newTestFritzBox(t, map[string]string{
+		"/upnp/control/wanipconnection1": "",
+		"/upnp/control/wanpppconn1":      "198.51.100.31",
+	})
+
+	ip, err := provider.GetPublicIP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.ParseIP("198.51.100.31")) {
+		t.Errorf("got %s, want 198.51.100.31", ip)
+	}
+	if stub.requests[len(stub.requests)-1] != "/upnp/control/wanpppconn1" {
+		t.Errorf("expected the last request to go to WANPPPConnection, got %v", stub.requests)
+	}
+}
+
+func TestFritzBoxIPv6(t *testing.T) {
+	_, provider := newTestFritzBox(t, map[string]string{
+		"/upnp/control/wanpppconn1": "2001:db8:4::1",
+	})
+
+	ip, err := provider.GetPublicIPv6()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.ParseIP("2001:db8:4::1")) {
+		t.Errorf("got %s, want 2001:db8:4::1", ip)
+	}
+}
+
+func TestFritzBoxNoAddress(t *testing.T) {
+	_, provider := newTestFritzBox(t, map[string]string{
+		"/upnp/control/wanipconnection1": "",
+	})
+
+	_, err := provider.GetPublicIP()
+	if err == nil || !strings.Contains(err.Error(), "is the internet connection up?") {
+		t.Errorf("expected an error about the missing address, got %v", err)
+	}
+}
+
+func TestFritzBoxWrongPassword(t *testing.T) {
+	stub, provider := newTestFritzBox(t, map[string]string{
+		"/upnp/control/wanipconnection1": "198.51.100.32",
+	})
+	stub.password = "other"
+
+	_, err := provider.GetPublicIP()
+	if err == nil || !strings.Contains(err.Error(), "status code 401") {
+		t.Errorf("expected an authentication error, got %v", err)
+	}
+}
+
+func TestDigestAuthorization(t *testing.T) {
+	credentials := digestCredentials{username: "user", password: "pass"}
+
+	// Example of RFC 2617 section 3.5 without qop
+	header, err := credentials.authorization(`Digest realm="testrealm@host.com", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`,
+		http.MethodGet, "http://host.com/dir/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parameters := parseDigestChallenge(header[len("Digest "):])
+	expected := md5Hex(md5Hex("user:testrealm@host.com:pass") + ":dcd98b7102dd2f0e8b11d0f600bfb0c093:" + md5Hex("GET:/dir/index.html"))
+	if parameters["response"] != expected {
+		t.Errorf("got response %s, want %s", parameters["response"], expected)
+	}
+	if parameters["uri"] != "/dir/index.html" || parameters["opaque"] != "5ccc069c403ebaf9f0171e9517f40e41" {
+		t.Errorf("unexpected parameters %v", parameters)
+	}
+	if _, ok := parameters["qop"]; ok {
+		t.Error("qop must not be sent if the server didn't offer it")
+	}
+
+	errorCases := map[string]string{
+		`Basic realm="box"`:  "didn't request digest",
+		`Digest realm="box"`: "nonce",
+		`Digest realm="box", nonce="1", algorithm=SHA-256`: "algorithm",
+		`Digest realm="box", nonce="1", qop="auth-int"`:    "qop",
+	}
+	for challenge, message := range errorCases {
+		_, err = credentials.authorization(challenge, http.MethodPost, "http://box/control")
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("challenge %s: expected error containing '%s', got %v", challenge, message, err)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package publicip
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"go.uber.org/zap"
+)
+
+const (
+	natPMPPort          = 5351
+	natPMPInitialWait   = 250 * time.Millisecond
+	natPMPRetries       = 4
+	pcpVersion          = 2
+	pcpOpcodeMap        = 1
+	pcpMapLifetime      = 30
+	pcpProtocolUDP      = 17
+	pcpHeaderLength     = 24
+	pcpMapPayloadLength = 36
+)
+
+// GatewayLookupProvider is a lookup provider that asks the local router for its external address
+// using UPnP IGD, NAT-PMP or PCP
+type GatewayLookupProvider struct {
+	logger         *zap.SugaredLogger
+	protocols      []string
+	gatewayAddress string
+	upnp           *upnpClient
+}
+
+// NewGatewayLookupProvider creates a new gateway lookup provider. Protocols are tried in the given
+// order until one of them succeeds.
+func NewGatewayLookupProvider(logger *zap.Logger, config *LookupProviderConfig) (*GatewayLookupProvider, error) {
+	protocols := config.GatewayProtocols
+	if len(protocols) == 0 {
+		protocols = []string{"upnp", "natpmp", "pcp"}
+	}
+	for _, protocol := range protocols {
+		if protocol != "upnp" && protocol != "natpmp" && protocol != "pcp" {
+			return nil, errors.New("'" + protocol + "' is not a valid gateway protocol")
+		}
+	}
+
+	return &GatewayLookupProvider{
+		logger:         logger.Sugar(),
+		protocols:      protocols,
+		gatewayAddress: config.GatewayAddress,
+		upnp:           newUPnPClient(config.UPnPLocation),
+	}, nil
+}
+
+// GetPublicIP returns the current public IP or nil if an error occurred
+func (p *GatewayLookupProvider) GetPublicIP() (net.IP, error) {
+	var lastErr error
+	for _, protocol := range p.protocols {
+		var ip net.IP
+		var err error
+
+		switch protocol {
+		case "upnp":
+			ip, err = p.upnp.getExternalIP()
+		case "natpmp":
+			ip, err = p.natPMPExternalIP()
+		case "pcp":
+			ip, err = p.pcpExternalIP()
+		}
+
+		if err == nil {
+			p.logger.Debugf("Gateway reported external address %s via %s", ip.String(), protocol)
+			return ip, nil
+		}
+		p.logger.Debugf("Gateway lookup via %s failed: %s", protocol, err)
+		lastErr = err
+	}
+
+	return nil, errors.New("was not able to get the external address from the gateway: " + lastErr.Error())
+}
+
+func (p *GatewayLookupProvider) GetPublicIPv6() (net.IP, error) {
+	return nil, errors.New("provider doesn't support IPv6 yet")
+}
+
+// natPMPExternalIP sends a NAT-PMP external address request (RFC 6886)
+func (p *GatewayLookupProvider) natPMPExternalIP() (net.IP, error) {
+	response, err := p.exchange([]byte{0, 0}, 12)
+	if err != nil {
+		return nil, err
+	}
+
+	if response[0] != 0 || response[1] != 128 {
+		return nil, errors.New("received an invalid NAT-PMP response")
+	}
+	if resultCode := binary.BigEndian.Uint16(response[2:4]); resultCode != 0 {
+		return nil, errors.New("NAT-PMP request failed with result code " + strconv.Itoa(int(resultCode)))
+	}
+
+	return net.IP(response[8:12]), nil
+}
+
+// pcpExternalIP creates a short-lived PCP mapping (RFC 6887) to learn the assigned external address
+// and removes the mapping again afterwards
+func (p *GatewayLookupProvider) pcpExternalIP() (net.IP, error) {
+	gateway, err := p.gateway()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("udp", gateway)
+	if err != nil {
+		return nil, err
+	}
+	clientIP := conn.LocalAddr().(*net.UDPAddr).IP
+	internalPort := uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+	conn.Close()
+
+	nonce := make([]byte, 12)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	request := pcpMapRequest(clientIP, nonce, internalPort, pcpMapLifetime)
+	response, err := p.exchange(request, pcpHeaderLength+pcpMapPayloadLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if response[0] != pcpVersion {
+		return nil, errors.New("gateway doesn't support PCP")
+	}
+	if response[1] != 0x80|pcpOpcodeMap {
+		return nil, errors.New("received an invalid PCP response")
+	}
+	if resultCode := response[3]; resultCode != 0 {
+		return nil, errors.New("PCP request failed with result code " + strconv.Itoa(int(resultCode)))
+	}
+	if !bytes.Equal(response[pcpHeaderLength:pcpHeaderLength+12], nonce) {
+		return nil, errors.New("received a PCP response for a different request")
+	}
+
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, response[pcpHeaderLength+20:pcpHeaderLength+36])
+
+	// Remove the mapping again, failures only leave a mapping that expires shortly
+	_, err = p.exchange(pcpMapRequest(clientIP, nonce, internalPort, 0), pcpHeaderLength+pcpMapPayloadLength)
+	if err != nil {
+		p.logger.Debug("Could not remove PCP mapping: ", err)
+	}
+
+	return ip, nil
+}
+
+func pcpMapRequest(clientIP net.IP, nonce []byte, internalPort uint16, lifetime uint32) []byte {
+	request := make([]byte, pcpHeaderLength+pcpMapPayloadLength)
+	request[0] = pcpVersion
+	request[1] = pcpOpcodeMap
+	binary.BigEndian.PutUint32(request[4:8], lifetime)
+	copy(request[8:24], clientIP.To16())
+
+	payload := request[pcpHeaderLength:]
+	copy(payload[0:12], nonce)
+	payload[12] = pcpProtocolUDP
+	binary.BigEndian.PutUint16(payload[16:18], internalPort)
+	// Leaving the suggested external address empty lets the gateway choose
+	copy(payload[20:36], net.IPv4zero.To16())
+
+	return request
+}
+
+// exchange sends request to the gateway's NAT-PMP/PCP port and waits for a response of at least
+// minLength bytes, retransmitting with an exponential backoff
+func (p *GatewayLookupProvider) exchange(request []byte, minLength int) ([]byte, error) {
+	gateway, err := p.gateway()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("udp", gateway)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	wait := natPMPInitialWait
+	buffer := make([]byte, 1100)
+	for i := 0; i < natPMPRetries; i++ {
+		_, err = conn.Write(request)
+		if err != nil {
+			return nil, err
+		}
+
+		err = conn.SetReadDeadline(time.Now().Add(wait))
+		if err != nil {
+			return nil, err
+		}
+		n, err := conn.Read(buffer)
+		if err == nil {
+			if n < 2 {
+				return nil, errors.New("received a truncated response")
+			}
+			// Version mismatches are answered with a short error response
+			if n < minLength && buffer[0] == request[0] {
+				return nil, errors.New("received a truncated response")
+			}
+			return buffer[:n], nil
+		}
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			return nil, err
+		}
+		wait *= 2
+	}
+
+	return nil, errors.New("gateway didn't respond")
+}
+
+// gateway returns the configured gateway address or the default gateway of the system
+func (p *GatewayLookupProvider) gateway() (string, error) {
+	if p.gatewayAddress != "" {
+		if _, _, err := net.SplitHostPort(p.gatewayAddress); err == nil {
+			return p.gatewayAddress, nil
+		}
+		return net.JoinHostPort(p.gatewayAddress, strconv.Itoa(natPMPPort)), nil
+	}
+
+	gateway, err := defaultGateway()
+	if err != nil {
+		return "", errors.New("could not determine the default gateway, please configure a gateway_address: " + err.Error())
+	}
+	return net.JoinHostPort(gateway.String(), strconv.Itoa(natPMPPort)), nil
+}
+
+// defaultGateway reads the IPv4 default gateway from the Linux routing table
+func defaultGateway() (net.IP, error) {
+	file, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		gateway, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil || gateway == 0 {
+			continue
+		}
+		// The kernel prints the address in network byte order as a host order integer, so storing it
+		// natively restores the original byte sequence
+		ip := make(net.IP, net.IPv4len)
+		*(*uint32)(unsafe.Pointer(&ip[0])) = uint32(gateway)
+		return ip, nil
+	}
+
+	return nil, errors.New("no default route found")
+}
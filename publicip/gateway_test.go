@@ -0,0 +1,247 @@
+package publicip
+
+import (
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// startUDPResponder answers every datagram received on a local port with the result of respond.
+// No answer is sent if respond returns nil.
+func startUDPResponder(t *testing.T, respond func(request []byte) []byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serveUDP(t, conn, respond)
+}
+
+func serveUDP(t *testing.T, conn net.PacketConn, respond func(request []byte) []byte) string {
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buffer := make([]byte, 1100)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			request := append([]byte{}, buffer[:n]...)
+			if response := respond(request); response != nil {
+				conn.WriteTo(response, addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func newTestGatewayProvider(t *testing.T, config *LookupProviderConfig) *GatewayLookupProvider {
+	t.Helper()
+	provider, err := NewGatewayLookupProvider(zap.NewNop(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestGatewayNATPMP(t *testing.T) {
+	gateway := startUDPResponder(t, func(request []byte) []byte {
+		if len(request) != 2 || request[0] != 0 || request[1] != 0 {
+			t.Errorf("unexpected NAT-PMP request %v", request)
+			return nil
+		}
+		response := make([]byte, 12)
+		response[1] = 128
+		binary.BigEndian.PutUint32(response[4:8], 1234)
+		copy(response[8:12], net.ParseIP("198.51.100.7").To4())
+		return response
+	})
+
+	provider := newTestGatewayProvider(t, &LookupProviderConfig{
+		GatewayAddress:   gateway,
+		GatewayProtocols: []string{"natpmp"},
+	})
+	ip, err := provider.GetPublicIP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.ParseIP("198.51.100.7")) {
+		t.Errorf("got %s, want 198.51.100.7", ip)
+	}
+}
+
+func TestGatewayNATPMPResultCode(t *testing.T) {
+	gateway := startUDPResponder(t, func(request []byte) []byte {
+		response := make([]byte, 12)
+		response[1] = 128
+		binary.BigEndian.PutUint16(response[2:4], 3)
+		return response
+	})
+
+	provider := newTestGatewayProvider(t, &LookupProviderConfig{
+		GatewayAddress:   gateway,
+		GatewayProtocols: []string{"natpmp"},
+	})
+	_, err := provider.GetPublicIP()
+	if err == nil || !strings.Contains(err.Error(), "result code 3") {
+		t.Errorf("expected result code error, got %v", err)
+	}
+}
+
+func TestGatewayPCP(t *testing.T) {
+	lifetimes := make(chan uint32, 2)
+	gateway := startUDPResponder(t, func(request []byte) []byte {
+		if len(request) != pcpHeaderLength+pcpMapPayloadLength || request[0] != pcpVersion || request[1] != pcpOpcodeMap {
+			t.Errorf("unexpected PCP request %v", request)
+			return nil
+		}
+		lifetimes <- binary.BigEndian.Uint32(request[4:8])
+
+		response := make([]byte, pcpHeaderLength+pcpMapPayloadLength)
+		response[0] = pcpVersion
+		response[1] = 0x80 | pcpOpcodeMap
+		copy(response[pcpHeaderLength:pcpHeaderLength+12], request[pcpHeaderLength:pcpHeaderLength+12])
+		copy(response[pcpHeaderLength+20:], net.ParseIP("203.0.113.9").To16())
+		return response
+	})
+
+	provider := newTestGatewayProvider(t, &LookupProviderConfig{
+		GatewayAddress:   gateway,
+		GatewayProtocols: []string{"pcp"},
+	})
+	ip, err := provider.GetPublicIP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.ParseIP("203.0.113.9")) {
+		t.Errorf("got %s, want 203.0.113.9", ip)
+	}
+
+	// The mapping is requested and removed again
+	if lifetime := <-lifetimes; lifetime != pcpMapLifetime {
+		t.Errorf("mapping requested with lifetime %d", lifetime)
+	}
+	if lifetime := <-lifetimes; lifetime != 0 {
+		t.Errorf("mapping removed with lifetime %d", lifetime)
+	}
+}
+
+func TestGatewayPCPNonceMismatch(t *testing.T) {
+	gateway := startUDPResponder(t, func(request []byte) []byte {
+		response := make([]byte, pcpHeaderLength+pcpMapPayloadLength)
+		response[0] = pcpVersion
+		response[1] = 0x80 | pcpOpcodeMap
+		return response
+	})
+
+	provider := newTestGatewayProvider(t, &LookupProviderConfig{
+		GatewayAddress:   gateway,
+		GatewayProtocols: []string{"pcp"},
+	})
+	_, err := provider.GetPublicIP()
+	if err == nil || !strings.Contains(err.Error(), "different request") {
+		t.Errorf("expected nonce error, got %v", err)
+	}
+}
+
+const testIGDDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+const testExternalIPResponse = `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Body>
+    <u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+      <NewExternalIPAddress>192.0.2.44</NewExternalIPAddress>
+    </u:GetExternalIPAddressResponse>
+  </s:Body>
+</s:Envelope>`
+
+func TestGatewayUPnP(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rootDesc.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testIGDDescription))
+	})
+	mux.HandleFunc("/ctl/IPConn", func(w http.ResponseWriter, r *http.Request) {
+		action := r.Header.Get("SOAPAction")
+		if action != `"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"` {
+			t.Errorf("unexpected SOAP action %s", action)
+		}
+		w.Write([]byte(testExternalIPResponse))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	provider := newTestGatewayProvider(t, &LookupProviderConfig{
+		GatewayProtocols: []string{"upnp"},
+		UPnPLocation:     server.URL + "/rootDesc.xml",
+	})
+	ip, err := provider.GetPublicIP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.ParseIP("192.0.2.44")) {
+		t.Errorf("got %s, want 192.0.2.44", ip)
+	}
+}
+
+func TestGatewayFallsBackToNextProtocol(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	gateway := startUDPResponder(t, func(request []byte) []byte {
+		response := make([]byte, 12)
+		response[1] = 128
+		copy(response[8:12], net.ParseIP("198.51.100.8").To4())
+		return response
+	})
+
+	provider := newTestGatewayProvider(t, &LookupProviderConfig{
+		GatewayAddress:   gateway,
+		GatewayProtocols: []string{"upnp", "natpmp"},
+		UPnPLocation:     server.URL + "/rootDesc.xml",
+	})
+	ip, err := provider.GetPublicIP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.ParseIP("198.51.100.8")) {
+		t.Errorf("got %s, want 198.51.100.8", ip)
+	}
+}
+
+func TestGatewayRejectsSourceBinding(t *testing.T) {
+	_, err := NewLookupProvider(zap.NewNop(), &LookupProviderConfig{
+		Service:       "gateway",
+		BindInterface: "wan2",
+	})
+	if err == nil || !strings.Contains(err.Error(), "doesn't support source_address and bind_interface") {
+		t.Errorf("expected bind_interface to be rejected, got %v", err)
+	}
+}
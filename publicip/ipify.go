@@ -1,83 +1,24 @@
 package publicip
 
 import (
-	"errors"
-	"io"
-	"net"
-	"net/http"
-	"strconv"
-	"time"
-
 	"go.uber.org/zap"
 )
 
 const (
-	url          = "https://api.ipify.org?format=text"
-	urlV6        = "https://api6.ipify.org?format=text"
-	numOfRetries = 3
-	timeout      = 1000
+	IpifyAddress      = "https://api.ipify.org?format=text"
+	ipifyNumOfRetries = 3
 )
 
-// IpifyLookupProvider is a public IP lookup provider using the ipify.org API
-type IpifyLookupProvider struct {
-	logger *zap.SugaredLogger
-}
-
-// NewIpifyLookupProvider creates a new Ipify lookup provider
-func NewIpifyLookupProvider(logger *zap.Logger) *IpifyLookupProvider {
-	return &IpifyLookupProvider{logger: logger.Sugar()}
-}
-
-// GetPublicIP returns the current public IP or nil if an error occured
-func (r *IpifyLookupProvider) GetPublicIP() (net.IP, error) {
-	var resp *http.Response
-
-	for i := 0; i < numOfRetries; i++ {
-		ret, err := r.getResponse()
-
-		if ret != nil && ret.StatusCode == http.StatusOK {
-			resp = ret
-			break
-		} else {
-			r.logger.Warn("Request failed: ", err)
-			time.Sleep(timeout * time.Millisecond)
-		}
-	}
-
-	if resp == nil {
-		return nil, errors.New("was not able to get a valid response")
-	}
-
-	defer resp.Body.Close()
-
-	ipBytes, err := io.ReadAll(resp.Body)
+// NewIpifyLookupProvider creates a new lookup provider using the ipify.org API
+func NewIpifyLookupProvider(logger *zap.Logger, config *LookupProviderConfig) (*HTTPLookupProvider, error) {
+	binding, err := newSourceBinding(config)
 	if err != nil {
 		return nil, err
 	}
 
-	ipString := string(ipBytes)
-
-	ip := net.ParseIP(ipString)
-	if ip == nil {
-		return nil, errors.New("'" + ipString + "' is not a valid IP address.")
-	}
-
-	return ip, nil
-}
-
-func (r *IpifyLookupProvider) GetPublicIPv6() (net.IP, error) {
-	return nil, errors.New("provider doesn't support IPv6 yet")
-}
-
-func (r *IpifyLookupProvider) getResponse() (*http.Response, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("Received status code " + strconv.Itoa(resp.StatusCode))
-	}
-
-	return resp, nil
+	return newHTTPLookupProvider(logger, httpLookupSettings{
+		urlV4:   IpifyAddress,
+		retries: ipifyNumOfRetries,
+		binding: binding,
+	})
 }
@@ -3,21 +3,59 @@ package publicip
 import (
 	"errors"
 	"net"
+	"path/filepath"
+	"sort"
 
 	"go.uber.org/zap"
 )
 
+// infiniteLifetime is the lifetime reported for addresses that never expire
+const infiniteLifetime = ^uint32(0)
+
 // LocalInterfaceLookupProvider is a lookup provider that will extract the public IP address from
 // a given interface
 type LocalInterfaceLookupProvider struct {
-	interfaceName string
-	logger        zap.SugaredLogger
+	interfaceName   string
+	includeNetworks []*net.IPNet
+	excludeNetworks []*net.IPNet
+	logger          zap.SugaredLogger
+}
+
+// interfaceAddress is an address assigned to a local interface together with the properties
+// that are relevant for choosing between multiple candidates. Where the platform can't provide
+// flags or lifetimes, addresses are reported as stable with an infinite lifetime.
+type interfaceAddress struct {
+	interfaceName     string
+	ip                net.IP
+	temporary         bool
+	deprecated        bool
+	tentative         bool
+	preferredLifetime uint32
 }
 
-// NewLocalInterfaceLookupProvider creates a new lookup provider
-func NewLocalInterfaceLookupProvider(logger *zap.Logger, interfaceName string) *LocalInterfaceLookupProvider {
-	r := LocalInterfaceLookupProvider{interfaceName: interfaceName, logger: *logger.Sugar()}
-	return &r
+// NewLocalInterfaceLookupProvider creates a new lookup provider. The interface name may be a glob
+// pattern like 'ppp*'.
+func NewLocalInterfaceLookupProvider(logger *zap.Logger, config *LookupProviderConfig) (*LocalInterfaceLookupProvider, error) {
+	if _, err := filepath.Match(config.InterfaceName, ""); err != nil {
+		return nil, errors.New("'" + config.InterfaceName + "' is not a valid interface name pattern")
+	}
+
+	includeNetworks, err := parseNetworks(config.IncludeNetworks)
+	if err != nil {
+		return nil, err
+	}
+	excludeNetworks, err := parseNetworks(config.ExcludeNetworks)
+	if err != nil {
+		return nil, err
+	}
+
+	r := LocalInterfaceLookupProvider{
+		interfaceName:   config.InterfaceName,
+		includeNetworks: includeNetworks,
+		excludeNetworks: excludeNetworks,
+		logger:          *logger.Sugar(),
+	}
+	return &r, nil
 }
 
 // GetPublicIP returns the current public IP or nil if an error occurred
@@ -29,46 +67,77 @@ func (r *LocalInterfaceLookupProvider) GetPublicIPv6() (net.IP, error) {
 	return r.getAddress(true)
 }
 
+// getAddress selects the best global unicast address of the requested family. Valid addresses are
+// preferred over deprecated ones, e.g. of a withdrawn prefix, stable addresses over temporary privacy
+// addresses and, among those, the address with the longest preferred lifetime wins.
 func (r *LocalInterfaceLookupProvider) getAddress(v6 bool) (net.IP, error) {
-	ip := net.IP{}
-	found := false
-
-	interfaces, err := net.Interfaces()
+	addresses, err := listInterfaceAddresses()
 	if err != nil {
 		return nil, err
 	}
-	for _, i := range interfaces {
-		if i.Name == r.interfaceName {
-			r.logger.Debug("Found interface " + i.Name)
-			addrs, err := i.Addrs()
-			if err != nil {
-				return nil, err
-			}
-			for _, addr := range addrs {
-				r.logger.Debug("Looking at address " + addr.String())
-				switch v := addr.(type) {
-				case *net.IPNet:
-					if v6 && (v.IP.IsGlobalUnicast() && len(v.IP) == net.IPv6len) ||
-						!v6 && (v.IP.IsGlobalUnicast() && len(v.IP) == net.IPv4len) {
-						r.logger.Debug("This is our address!")
-						ip = v.IP
-						found = true
-						break
-					}
-					continue
-				default:
-					r.logger.Warn("Skipping address type that hover-ddns doesn't understand")
-				}
-				if found {
-					break
-				}
-			}
+
+	candidates := []interfaceAddress{}
+	for _, a := range addresses {
+		if matched, _ := filepath.Match(r.interfaceName, a.interfaceName); !matched {
+			continue
 		}
+		r.logger.Debugf("Looking at address %s on interface %s (temporary: %t, deprecated: %t, tentative: %t, lifetime: %d)",
+			a.ip.String(), a.interfaceName, a.temporary, a.deprecated, a.tentative, a.preferredLifetime)
+
+		if !a.ip.IsGlobalUnicast() || (a.ip.To4() == nil) != v6 {
+			continue
+		}
+		if a.tentative {
+			r.logger.Debug("Skipping tentative address")
+			continue
+		}
+		if len(r.includeNetworks) > 0 && !containsIP(r.includeNetworks, a.ip) {
+			r.logger.Debug("Skipping address that is not part of the included networks")
+			continue
+		}
+		if containsIP(r.excludeNetworks, a.ip) {
+			r.logger.Debug("Skipping address that is part of the excluded networks")
+			continue
+		}
+		candidates = append(candidates, a)
 	}
 
-	if !found {
+	if len(candidates) == 0 {
 		return nil, errors.New("was not able to find IP address on interface '" + r.interfaceName + "'")
 	}
 
-	return ip, nil
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.deprecated != b.deprecated {
+			return !a.deprecated
+		}
+		if a.temporary != b.temporary {
+			return !a.temporary
+		}
+		return a.preferredLifetime > b.preferredLifetime
+	})
+
+	r.logger.Debugf("Selected address %s on interface %s", candidates[0].ip.String(), candidates[0].interfaceName)
+	return candidates[0].ip, nil
+}
+
+func parseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.New("'" + cidr + "' is not a valid network")
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,217 @@
+//go:build linux
+// +build linux
+
+package publicip
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// Netlink attribute carrying the full 32 bit address flags. The flags field of IfAddrmsg only holds
+	// the lower 8 bits.
+	ifaFlags = 0x8
+
+	// Netlink multicast groups for address changes
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv6IfAddr = 0x100
+)
+
+// WatchInterfaceAddresses subscribes to netlink address events and sends on changes whenever an
+// address is added to or removed from an interface matching interfaceName. Lifetime refreshes of
+// known addresses are ignored. The subscription runs in the background until the process exits.
+func WatchInterfaceAddresses(logger *zap.Logger, interfaceName string, changes chan<- struct{}) error {
+	if _, err := filepath.Match(interfaceName, ""); err != nil {
+		return errors.New("'" + interfaceName + "' is not a valid interface name pattern")
+	}
+	sugaredLogger := logger.Sugar()
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpIPv4IfAddr | rtmgrpIPv6IfAddr,
+	})
+	if err != nil {
+		syscall.Close(fd)
+		return err
+	}
+
+	// Remember the current addresses so that only actual changes are reported
+	known := map[string]bool{}
+	addresses, err := listInterfaceAddresses()
+	if err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	for _, a := range addresses {
+		if matched, _ := filepath.Match(interfaceName, a.interfaceName); matched {
+			known[a.interfaceName+"/"+a.ip.String()] = true
+		}
+	}
+
+	go func() {
+		defer syscall.Close(fd)
+		// Interface names are cached so that removals can still be attributed after an interface
+		// such as ppp0 has disappeared
+		names := interfaceNames()
+		buffer := make([]byte, 65536)
+		for {
+			n, _, err := syscall.Recvfrom(fd, buffer, 0)
+			if err != nil {
+				if err == syscall.EINTR || err == syscall.ENOBUFS {
+					continue
+				}
+				sugaredLogger.Error("Stopped watching address changes: ", err)
+				return
+			}
+
+			messages, err := syscall.ParseNetlinkMessage(buffer[:n])
+			if err != nil {
+				sugaredLogger.Warn("Could not parse netlink message: ", err)
+				continue
+			}
+
+			for index, name := range interfaceNames() {
+				names[index] = name
+			}
+
+			changed := false
+			for _, m := range messages {
+				if m.Header.Type != syscall.RTM_NEWADDR && m.Header.Type != syscall.RTM_DELADDR {
+					continue
+				}
+				a, ok := parseAddressMessage(&m, names)
+				if !ok {
+					continue
+				}
+				if matched, _ := filepath.Match(interfaceName, a.interfaceName); !matched {
+					continue
+				}
+
+				key := a.interfaceName + "/" + a.ip.String()
+				if m.Header.Type == syscall.RTM_NEWADDR && !known[key] {
+					sugaredLogger.Infof("Address %s was added to interface %s", a.ip.String(), a.interfaceName)
+					known[key] = true
+					changed = true
+				} else if m.Header.Type == syscall.RTM_DELADDR && known[key] {
+					sugaredLogger.Infof("Address %s was removed from interface %s", a.ip.String(), a.interfaceName)
+					delete(known, key)
+					changed = true
+				}
+			}
+
+			if changed {
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// listInterfaceAddresses dumps all addresses via netlink, which in contrast to net.Interface.Addrs
+// also reports address flags and lifetimes.
+func listInterfaceAddresses() ([]interfaceAddress, error) {
+	names := interfaceNames()
+
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETADDR, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := []interfaceAddress{}
+	for _, m := range messages {
+		if m.Header.Type != syscall.RTM_NEWADDR {
+			continue
+		}
+		a, ok := parseAddressMessage(&m, names)
+		if ok {
+			addresses = append(addresses, a)
+		}
+	}
+
+	return addresses, nil
+}
+
+// interfaceNames maps interface indices to their names
+func interfaceNames() map[int]string {
+	names := map[int]string{}
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return names
+	}
+	for _, i := range interfaces {
+		names[i.Index] = i.Name
+	}
+	return names
+}
+
+// parseAddressMessage converts an RTM_NEWADDR or RTM_DELADDR message into an interfaceAddress
+func parseAddressMessage(m *syscall.NetlinkMessage, names map[int]string) (interfaceAddress, bool) {
+	if len(m.Data) < syscall.SizeofIfAddrmsg {
+		return interfaceAddress{}, false
+	}
+	header := (*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+
+	attributes, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return interfaceAddress{}, false
+	}
+
+	a := interfaceAddress{
+		interfaceName:     names[int(header.Index)],
+		preferredLifetime: infiniteLifetime,
+	}
+	flags := uint32(header.Flags)
+	var local, address net.IP
+
+	for _, attribute := range attributes {
+		switch attribute.Attr.Type {
+		case syscall.IFA_ADDRESS:
+			address = net.IP(attribute.Value)
+		case syscall.IFA_LOCAL:
+			local = net.IP(attribute.Value)
+		case ifaFlags:
+			if len(attribute.Value) >= 4 {
+				flags = *(*uint32)(unsafe.Pointer(&attribute.Value[0]))
+			}
+		case syscall.IFA_CACHEINFO:
+			if len(attribute.Value) >= 4 {
+				// struct ifa_cacheinfo starts with the preferred lifetime in seconds
+				a.preferredLifetime = *(*uint32)(unsafe.Pointer(&attribute.Value[0]))
+			}
+		}
+	}
+
+	// On point-to-point links IFA_ADDRESS is the peer address and IFA_LOCAL is our own
+	if local != nil {
+		a.ip = local
+	} else {
+		a.ip = address
+	}
+	if a.ip == nil {
+		return interfaceAddress{}, false
+	}
+
+	a.temporary = flags&syscall.IFA_F_TEMPORARY != 0 && header.Family == syscall.AF_INET6
+	a.deprecated = flags&syscall.IFA_F_DEPRECATED != 0
+	a.tentative = flags&(syscall.IFA_F_TENTATIVE|syscall.IFA_F_DADFAILED) != 0
+
+	return a, true
+}
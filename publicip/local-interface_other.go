@@ -0,0 +1,44 @@
+//go:build !linux
+// +build !linux
+
+package publicip
+
+import (
+	"errors"
+	"net"
+
+	"go.uber.org/zap"
+)
+
+// listInterfaceAddresses lists all interface addresses. Address flags and lifetimes are not
+// available on this platform, so all addresses are reported as stable.
+func listInterfaceAddresses() ([]interfaceAddress, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := []interfaceAddress{}
+	for _, i := range interfaces {
+		addrs, err := i.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if v, ok := addr.(*net.IPNet); ok {
+				addresses = append(addresses, interfaceAddress{
+					interfaceName:     i.Name,
+					ip:                v.IP,
+					preferredLifetime: infiniteLifetime,
+				})
+			}
+		}
+	}
+
+	return addresses, nil
+}
+
+// WatchInterfaceAddresses is not supported on this platform and always returns an error
+func WatchInterfaceAddresses(logger *zap.Logger, interfaceName string, changes chan<- struct{}) error {
+	return errors.New("watching address changes is not supported on this platform")
+}
@@ -3,14 +3,48 @@ package publicip
 import (
 	"errors"
 	"net"
+	"time"
 
 	"go.uber.org/zap"
 )
 
 // LookupProviderConfig is a configuration from which a lookup provider can be selected and configured
 type LookupProviderConfig struct {
-	Service       string
-	InterfaceName string `yaml:"interface_name"`
+	Service         string
+	InterfaceName   string              `yaml:"interface_name"`
+	IncludeNetworks []string            `yaml:"include_networks"`
+	ExcludeNetworks []string            `yaml:"exclude_networks"`
+	AddressPolicy   AddressPolicyConfig `yaml:"address_policy"`
+	// Restricts the lookups of the HTTP based, stun and dns providers to a local address or interface
+	SourceAddress string `yaml:"source_address"`
+	BindInterface string `yaml:"bind_interface"`
+	// Settings of the gateway provider
+	GatewayAddress   string   `yaml:"gateway_address"`
+	GatewayProtocols []string `yaml:"gateway_protocols"`
+	UPnPLocation     string   `yaml:"upnp_location"`
+	// Settings of the stun provider
+	STUNServers []string `yaml:"stun_servers"`
+	// Settings of the dns provider
+	DNSQueryName string `yaml:"dns_query_name"`
+	DNSQueryType string `yaml:"dns_query_type"`
+	DNSServer    string `yaml:"dns_server"`
+	// Settings of the custom_http provider
+	HTTPURL      string            `yaml:"http_url"`
+	HTTPURLV6    string            `yaml:"http_url_v6"`
+	HTTPHeaders  map[string]string `yaml:"http_headers"`
+	HTTPUsername string            `yaml:"http_username"`
+	HTTPPassword string            `yaml:"http_password"`
+	HTTPRegex    string            `yaml:"http_regex"`
+	HTTPJSONPath string            `yaml:"http_json_path"`
+	// Settings of the command provider
+	Command        string        `yaml:"command"`
+	CommandArgsV4  []string      `yaml:"command_args_v4"`
+	CommandArgsV6  []string      `yaml:"command_args_v6"`
+	CommandTimeout time.Duration `yaml:"command_timeout"`
+	// Settings of the fritzbox provider
+	FritzBoxURL      string `yaml:"fritzbox_url"`
+	FritzBoxUsername string `yaml:"fritzbox_username"`
+	FritzBoxPassword string `yaml:"fritzbox_password"`
 }
 
 // LookupProvider is an interface for a provider that can resolve the current public IP address
@@ -19,20 +53,91 @@ type LookupProvider interface {
 	GetPublicIPv6() (net.IP, error)
 }
 
-// NewLookupProvider creates a new lookup provider from a given configuration
+// NewLookupProvider creates a new lookup provider from a given configuration. All results of the
+// provider are checked against the configured address policy.
 func NewLookupProvider(logger *zap.Logger, config *LookupProviderConfig) (LookupProvider, error) {
+	policy, err := NewAddressPolicy(&config.AddressPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := newServiceLookupProvider(logger, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &policyLookupProvider{provider: provider, policy: policy}, nil
+}
+
+func newServiceLookupProvider(logger *zap.Logger, config *LookupProviderConfig) (LookupProvider, error) {
+	// These providers don't open connections of their own to the internet, so they can't be tied to an uplink
+	switch config.Service {
+	case "local_interface", "command", "fritzbox", "gateway":
+		if config.SourceAddress != "" || config.BindInterface != "" {
+			return nil, errors.New("the " + config.Service + " service doesn't support source_address and bind_interface")
+		}
+	}
+
 	switch config.Service {
 	case "ipify":
-		return NewIpifyLookupProvider(logger), nil
+		provider, err := NewIpifyLookupProvider(logger, config)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
 	case "amazon":
-		return NewAmazonLookupProvider(), nil
+		provider, err := NewAmazonLookupProvider(logger, config)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
 	case "icanhazip":
-		return NewIcanhazipLookupProvider(), nil
+		provider, err := NewIcanhazipLookupProvider(logger, config)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	case "custom_http":
+		provider, err := NewHTTPLookupProvider(logger, config)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
 	case "local_interface":
 		if config.InterfaceName == "" {
 			return nil, errors.New("for the local_interface service, an interface_name must be provided")
 		}
-		return NewLocalInterfaceLookupProvider(logger, config.InterfaceName), nil
+		provider, err := NewLocalInterfaceLookupProvider(logger, config)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	case "stun":
+		provider, err := NewSTUNLookupProvider(logger, config)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	case "dns":
+		provider, err := NewDNSLookupProvider(logger, config)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	case "command":
+		provider, err := NewCommandLookupProvider(logger, config)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	case "fritzbox":
+		return NewFritzBoxLookupProvider(logger, config), nil
+	case "gateway":
+		provider, err := NewGatewayLookupProvider(logger, config)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
 	default:
 		return nil, errors.New("'" + config.Service + "' is not a valid service")
 	}
@@ -0,0 +1,56 @@
+package publicip
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// sourceBindingDialTimeout matches the dial timeout of http.DefaultTransport
+const sourceBindingDialTimeout = 30 * time.Second
+
+// sourceBinding restricts the connections of a lookup provider to a local address and/or interface,
+// so that on hosts with multiple uplinks the address of a specific uplink is determined
+type sourceBinding struct {
+	address       net.IP
+	interfaceName string
+}
+
+func newSourceBinding(config *LookupProviderConfig) (*sourceBinding, error) {
+	binding := sourceBinding{interfaceName: config.BindInterface}
+
+	if config.SourceAddress != "" {
+		binding.address = net.ParseIP(config.SourceAddress)
+		if binding.address == nil {
+			return nil, errors.New("'" + config.SourceAddress + "' is not a valid source address")
+		}
+	}
+
+	if binding.interfaceName != "" && !bindToDeviceSupported {
+		return nil, errors.New("bind_interface is not supported on this platform")
+	}
+
+	return &binding, nil
+}
+
+// dialer returns a dialer for the given network like 'tcp4' or 'udp6'. The source address is only
+// applied to connections of its own address family.
+func (b *sourceBinding) dialer(network string) *net.Dialer {
+	dialer := net.Dialer{Timeout: sourceBindingDialTimeout}
+
+	v6 := strings.HasSuffix(network, "6")
+	if b.address != nil && (b.address.To4() == nil) == v6 {
+		if strings.HasPrefix(network, "udp") {
+			dialer.LocalAddr = &net.UDPAddr{IP: b.address}
+		} else {
+			dialer.LocalAddr = &net.TCPAddr{IP: b.address}
+		}
+	}
+
+	if b.interfaceName != "" {
+		dialer.Control = bindToDevice(b.interfaceName)
+	}
+
+	return &dialer
+}
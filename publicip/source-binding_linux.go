@@ -0,0 +1,25 @@
+//go:build linux
+// +build linux
+
+package publicip
+
+import (
+	"syscall"
+)
+
+const bindToDeviceSupported = true
+
+// bindToDevice returns a dialer control function that binds sockets to the given interface
+// using SO_BINDTODEVICE
+func bindToDevice(interfaceName string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var bindErr error
+		err := c.Control(func(fd uintptr) {
+			bindErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, interfaceName)
+		})
+		if err != nil {
+			return err
+		}
+		return bindErr
+	}
+}
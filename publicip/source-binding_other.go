@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package publicip
+
+import (
+	"syscall"
+)
+
+const bindToDeviceSupported = false
+
+// bindToDevice is not supported on this platform. newSourceBinding rejects interface bindings, so
+// this is never called.
+func bindToDevice(interfaceName string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,209 @@
+package publicip
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	stunBindingRequest        = 0x0001
+	stunBindingSuccess        = 0x0101
+	stunMagicCookie           = 0x2112A442
+	stunHeaderLength          = 20
+	stunAttrMappedAddress     = 0x0001
+	stunAttrXorMappedAddress  = 0x0020
+	stunFamilyIPv4            = 0x01
+	stunFamilyIPv6            = 0x02
+	stunInitialRetransmission = 500 * time.Millisecond
+	stunRetries               = 3
+)
+
+// DefaultSTUNServers are used if no STUN servers were configured
+var DefaultSTUNServers = []string{
+	"stun.l.google.com:19302",
+	"stun.cloudflare.com:3478",
+}
+
+// STUNLookupProvider is a public IP lookup provider that sends STUN Binding Requests (RFC 5389)
+type STUNLookupProvider struct {
+	logger  *zap.SugaredLogger
+	servers []string
+	binding *sourceBinding
+}
+
+// NewSTUNLookupProvider creates a new STUN lookup provider. The servers are queried in the given order.
+func NewSTUNLookupProvider(logger *zap.Logger, config *LookupProviderConfig) (*STUNLookupProvider, error) {
+	servers := config.STUNServers
+	if len(servers) == 0 {
+		servers = DefaultSTUNServers
+	}
+	binding, err := newSourceBinding(config)
+	if err != nil {
+		return nil, err
+	}
+	return &STUNLookupProvider{logger: logger.Sugar(), servers: servers, binding: binding}, nil
+}
+
+// GetPublicIP returns the current public IP or nil if an error occurred
+func (p *STUNLookupProvider) GetPublicIP() (net.IP, error) {
+	return p.getAddress(false)
+}
+
+func (p *STUNLookupProvider) GetPublicIPv6() (net.IP, error) {
+	return p.getAddress(true)
+}
+
+func (p *STUNLookupProvider) getAddress(v6 bool) (net.IP, error) {
+	network := "udp4"
+	if v6 {
+		network = "udp6"
+	}
+
+	var lastErr error
+	for _, server := range p.servers {
+		ip, err := stunBinding(p.binding.dialer(network), network, server)
+		if err == nil {
+			return ip, nil
+		}
+		p.logger.Debugf("STUN request to %s via %s failed: %s", server, network, err)
+		lastErr = err
+	}
+
+	return nil, errors.New("no STUN server returned an address: " + lastErr.Error())
+}
+
+// stunBinding sends a Binding Request to server and returns the reflexive address from the response
+func stunBinding(dialer *net.Dialer, network string, server string) (net.IP, error) {
+	conn, err := dialer.Dial(network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	request := make([]byte, stunHeaderLength)
+	binary.BigEndian.PutUint16(request[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:8], stunMagicCookie)
+	_, err = rand.Read(request[8:20])
+	if err != nil {
+		return nil, err
+	}
+	transactionID := request[8:20]
+
+	wait := stunInitialRetransmission
+	buffer := make([]byte, 1500)
+	for i := 0; i < stunRetries; i++ {
+		_, err = conn.Write(request)
+		if err != nil {
+			return nil, err
+		}
+
+		err = conn.SetReadDeadline(time.Now().Add(wait))
+		if err != nil {
+			return nil, err
+		}
+		n, err := conn.Read(buffer)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				wait *= 2
+				continue
+			}
+			return nil, err
+		}
+
+		response := buffer[:n]
+		if n < stunHeaderLength || !bytes.Equal(response[8:20], transactionID) {
+			// Not an answer to our request, keep waiting with the next retransmission
+			continue
+		}
+		return parseSTUNResponse(response)
+	}
+
+	return nil, errors.New("STUN server didn't respond")
+}
+
+// parseSTUNResponse extracts the (XOR-)MAPPED-ADDRESS from a Binding Success Response
+func parseSTUNResponse(response []byte) (net.IP, error) {
+	if binary.BigEndian.Uint16(response[0:2]) != stunBindingSuccess {
+		return nil, errors.New("received an unsuccessful STUN response")
+	}
+	if binary.BigEndian.Uint32(response[4:8]) != stunMagicCookie {
+		return nil, errors.New("received a STUN response without magic cookie")
+	}
+
+	length := int(binary.BigEndian.Uint16(response[2:4]))
+	if stunHeaderLength+length > len(response) {
+		return nil, errors.New("received a truncated STUN response")
+	}
+	attributes := response[stunHeaderLength : stunHeaderLength+length]
+
+	var mapped net.IP
+	for len(attributes) >= 4 {
+		attrType := binary.BigEndian.Uint16(attributes[0:2])
+		attrLength := int(binary.BigEndian.Uint16(attributes[2:4]))
+		if 4+attrLength > len(attributes) {
+			return nil, errors.New("received a malformed STUN attribute")
+		}
+		value := attributes[4 : 4+attrLength]
+
+		switch attrType {
+		case stunAttrXorMappedAddress:
+			ip, err := parseSTUNAddress(value)
+			if err != nil {
+				return nil, err
+			}
+			// XOR with the magic cookie followed by the transaction ID
+			key := response[4:20]
+			for i := range ip {
+				ip[i] ^= key[i]
+			}
+			return ip, nil
+		case stunAttrMappedAddress:
+			ip, err := parseSTUNAddress(value)
+			if err != nil {
+				return nil, err
+			}
+			mapped = ip
+		}
+
+		// Attributes are padded to a multiple of four bytes
+		padded := (attrLength + 3) &^ 3
+		if 4+padded > len(attributes) {
+			break
+		}
+		attributes = attributes[4+padded:]
+	}
+
+	if mapped != nil {
+		return mapped, nil
+	}
+	return nil, errors.New("STUN response didn't contain a mapped address")
+}
+
+func parseSTUNAddress(value []byte) (net.IP, error) {
+	if len(value) < 4 {
+		return nil, errors.New("received a malformed STUN address")
+	}
+
+	var length int
+	switch value[1] {
+	case stunFamilyIPv4:
+		length = net.IPv4len
+	case stunFamilyIPv6:
+		length = net.IPv6len
+	default:
+		return nil, errors.New("received an unknown STUN address family")
+	}
+	if len(value) < 4+length {
+		return nil, errors.New("received a malformed STUN address")
+	}
+
+	ip := make(net.IP, length)
+	copy(ip, value[4:4+length])
+	return ip, nil
+}
@@ -0,0 +1,168 @@
+package publicip
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+// stunAttribute encodes an address attribute. If xor is set, the address is obfuscated with the magic
+// cookie and transaction ID of request.
+func stunAttribute(attrType uint16, ip net.IP, xor bool, request []byte) []byte {
+	family := byte(stunFamilyIPv6)
+	if ip.To4() != nil {
+		family = stunFamilyIPv4
+		ip = ip.To4()
+	}
+
+	value := make([]byte, 4+len(ip))
+	value[1] = family
+	copy(value[4:], ip)
+	if xor {
+		key := append(append([]byte{}, request[4:8]...), request[8:20]...)
+		for i := range ip {
+			value[4+i] ^= key[i]
+		}
+	}
+
+	attribute := make([]byte, 4)
+	binary.BigEndian.PutUint16(attribute[0:2], attrType)
+	binary.BigEndian.PutUint16(attribute[2:4], uint16(len(value)))
+	return append(attribute, value...)
+}
+
+// stunResponse builds a Binding Success Response to request with the given attributes
+func stunResponse(request []byte, attributes ...[]byte) []byte {
+	response := make([]byte, stunHeaderLength)
+	binary.BigEndian.PutUint16(response[0:2], stunBindingSuccess)
+	binary.BigEndian.PutUint32(response[4:8], stunMagicCookie)
+	copy(response[8:20], request[8:20])
+	for _, attribute := range attributes {
+		response = append(response, attribute...)
+	}
+	binary.BigEndian.PutUint16(response[2:4], uint16(len(response)-stunHeaderLength))
+	return response
+}
+
+func startSTUNServer(t *testing.T, conn net.PacketConn, attributes func(request []byte) [][]byte) string {
+	t.Helper()
+	return serveUDP(t, conn, func(request []byte) []byte {
+		if len(request) != stunHeaderLength || binary.BigEndian.Uint16(request[0:2]) != stunBindingRequest ||
+			binary.BigEndian.Uint32(request[4:8]) != stunMagicCookie {
+			t.Errorf("unexpected STUN request %v", request)
+			return nil
+		}
+		return stunResponse(request, attributes(request)...)
+	})
+}
+
+func listenUDP(t *testing.T, network string, address string) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		if network == "udp6" {
+			t.Skip("IPv6 loopback not available: ", err)
+		}
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestSTUNBinding(t *testing.T) {
+	tests := []struct {
+		name     string
+		network  string
+		attrType uint16
+		ip       string
+		xor      bool
+	}{
+		{"XOR IPv4", "udp4", stunAttrXorMappedAddress, "198.51.100.20", true},
+		{"XOR IPv6", "udp6", stunAttrXorMappedAddress, "2001:db8:1234::20", true},
+		{"plain IPv4", "udp4", stunAttrMappedAddress, "198.51.100.21", false},
+		{"plain IPv6", "udp6", stunAttrMappedAddress, "2001:db8:1234::21", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			address := "127.0.0.1:0"
+			if test.network == "udp6" {
+				address = "[::1]:0"
+			}
+			server := startSTUNServer(t, listenUDP(t, test.network, address), func(request []byte) [][]byte {
+				return [][]byte{stunAttribute(test.attrType, net.ParseIP(test.ip), test.xor, request)}
+			})
+
+			ip, err := stunBinding(&net.Dialer{}, test.network, server)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ip.Equal(net.ParseIP(test.ip)) {
+				t.Errorf("got %s, want %s", ip, test.ip)
+			}
+		})
+	}
+}
+
+func TestSTUNBindingPrefersXORMappedAddress(t *testing.T) {
+	server := startSTUNServer(t, listenUDP(t, "udp4", "127.0.0.1:0"), func(request []byte) [][]byte {
+		return [][]byte{
+			stunAttribute(stunAttrMappedAddress, net.ParseIP("10.0.0.1"), false, request),
+			stunAttribute(stunAttrXorMappedAddress, net.ParseIP("198.51.100.22"), true, request),
+		}
+	})
+
+	ip, err := stunBinding(&net.Dialer{}, "udp4", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.ParseIP("198.51.100.22")) {
+		t.Errorf("got %s, want 198.51.100.22", ip)
+	}
+}
+
+func TestParseSTUNResponseErrors(t *testing.T) {
+	request := make([]byte, stunHeaderLength)
+	binary.BigEndian.PutUint16(request[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:8], stunMagicCookie)
+	copy(request[8:20], "transaction!")
+
+	valid := stunAttribute(stunAttrXorMappedAddress, net.ParseIP("198.51.100.23"), true, request)
+
+	truncatedMessage := stunResponse(request, valid)
+	truncatedMessage = truncatedMessage[:len(truncatedMessage)-2]
+
+	truncatedAttribute := append([]byte{}, valid...)
+	binary.BigEndian.PutUint16(truncatedAttribute[2:4], 64)
+
+	shortAddress := append([]byte{}, valid[:6]...)
+	binary.BigEndian.PutUint16(shortAddress[2:4], 2)
+
+	unknownFamily := append([]byte{}, valid...)
+	unknownFamily[5] = 0x03
+
+	failure := stunResponse(request, valid)
+	binary.BigEndian.PutUint16(failure[0:2], 0x0111)
+
+	tests := []struct {
+		name     string
+		response []byte
+		err      string
+	}{
+		{"error response", failure, "unsuccessful"},
+		{"truncated message", truncatedMessage, "truncated STUN response"},
+		{"truncated attribute", stunResponse(request, truncatedAttribute), "malformed STUN attribute"},
+		{"short address", stunResponse(request, shortAddress), "malformed STUN address"},
+		{"unknown family", stunResponse(request, unknownFamily), "unknown STUN address family"},
+		{"no address", stunResponse(request), "didn't contain a mapped address"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseSTUNResponse(test.response)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error containing '%s', got %v", test.err, err)
+			}
+		})
+	}
+}
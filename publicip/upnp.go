@@ -0,0 +1,233 @@
+package publicip
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ssdpAddress     = "239.255.255.250:1900"
+	ssdpSearchType  = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+	ssdpTimeout     = 3 * time.Second
+	soapEnvelope    = `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><u:%ACTION% xmlns:u="%SERVICE%"></u:%ACTION%></s:Body></s:Envelope>`
+	upnpHTTPTimeout = 5 * time.Second
+)
+
+// upnpWANServices are the service types that provide GetExternalIPAddress, in order of preference
+var upnpWANServices = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+type upnpDescription struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+type upnpDevice struct {
+	Services []upnpService `xml:"serviceList>service"`
+	Devices  []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+type upnpExternalIPResponse struct {
+	ExternalIPAddress string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+}
+
+// upnpClient queries an UPnP internet gateway device for its external address
+type upnpClient struct {
+	httpClient *http.Client
+	location   string
+}
+
+func newUPnPClient(location string) *upnpClient {
+	return &upnpClient{
+		httpClient: &http.Client{Timeout: upnpHTTPTimeout},
+		location:   location,
+	}
+}
+
+// getExternalIP discovers the gateway if no location was configured and calls GetExternalIPAddress
+func (c *upnpClient) getExternalIP() (net.IP, error) {
+	location := c.location
+	if location == "" {
+		var err error
+		location, err = discoverGateway()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	controlURL, serviceType, err := c.getControlURL(location)
+	if err != nil {
+		return nil, err
+	}
+
+	response := upnpExternalIPResponse{}
+	err = soapRequest(c.httpClient, nil, controlURL, serviceType, "GetExternalIPAddress", &response)
+	if err != nil {
+		return nil, err
+	}
+
+	ipString := strings.TrimSpace(response.ExternalIPAddress)
+	ip := net.ParseIP(ipString)
+	if ip == nil {
+		return nil, errors.New("'" + ipString + "' is not a valid IP address.")
+	}
+
+	return ip, nil
+}
+
+// getControlURL fetches the device description and returns the control URL of the WAN connection service
+func (c *upnpClient) getControlURL(location string) (string, string, error) {
+	resp, err := c.httpClient.Get(location)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", errors.New("received status code " + strconv.Itoa(resp.StatusCode))
+	}
+
+	description := upnpDescription{}
+	err = xml.NewDecoder(resp.Body).Decode(&description)
+	if err != nil {
+		return "", "", err
+	}
+
+	services := collectUPnPServices(&description.Device)
+	for _, serviceType := range upnpWANServices {
+		for _, service := range services {
+			if service.ServiceType != serviceType {
+				continue
+			}
+
+			base := location
+			if description.URLBase != "" {
+				base = description.URLBase
+			}
+			baseURL, err := neturl.Parse(base)
+			if err != nil {
+				return "", "", err
+			}
+			controlURL, err := baseURL.Parse(service.ControlURL)
+			if err != nil {
+				return "", "", err
+			}
+			return controlURL.String(), serviceType, nil
+		}
+	}
+
+	return "", "", errors.New("gateway doesn't provide a WAN connection service")
+}
+
+func collectUPnPServices(device *upnpDevice) []upnpService {
+	services := append([]upnpService{}, device.Services...)
+	for i := range device.Devices {
+		services = append(services, collectUPnPServices(&device.Devices[i])...)
+	}
+	return services
+}
+
+// discoverGateway searches for an internet gateway device via SSDP and returns its description location
+func discoverGateway() (string, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	destination, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if err != nil {
+		return "", err
+	}
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddress + "\r\n" +
+		"ST: " + ssdpSearchType + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n\r\n"
+	_, err = conn.WriteTo([]byte(search), destination)
+	if err != nil {
+		return "", err
+	}
+
+	err = conn.SetReadDeadline(time.Now().Add(ssdpTimeout))
+	if err != nil {
+		return "", err
+	}
+	buffer := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return "", errors.New("no internet gateway device found: " + err.Error())
+		}
+		for _, line := range strings.Split(string(buffer[:n]), "\r\n") {
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), "location") {
+				return strings.TrimSpace(parts[1]), nil
+			}
+		}
+	}
+}
+
+// soapRequest calls a SOAP action without arguments and decodes the response envelope into response.
+// If credentials are provided, a digest authentication challenge of the server is answered.
+func soapRequest(client *http.Client, credentials *digestCredentials, controlURL string, serviceType string, action string, response interface{}) error {
+	resp, err := doSOAPRequest(client, controlURL, serviceType, action, "")
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && credentials != nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		authorization, err := credentials.authorization(resp.Header.Get("WWW-Authenticate"), http.MethodPost, controlURL)
+		if err != nil {
+			return err
+		}
+		resp, err = doSOAPRequest(client, controlURL, serviceType, action, authorization)
+		if err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return errors.New("received status code " + strconv.Itoa(resp.StatusCode))
+	}
+
+	return xml.NewDecoder(resp.Body).Decode(response)
+}
+
+func doSOAPRequest(client *http.Client, controlURL string, serviceType string, action string, authorization string) (*http.Response, error) {
+	body := strings.NewReplacer("%ACTION%", action, "%SERVICE%", serviceType).Replace(soapEnvelope)
+
+	req, err := http.NewRequest(http.MethodPost, controlURL, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+serviceType+"#"+action+`"`)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	return client.Do(req)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	familyIPv4 = "ipv4"
+	familyIPv6 = "ipv6"
+
+	actionUpdate = "update"
+	actionNone   = "none"
+	actionSkip   = "skip"
+
+	propagated    = "propagated"
+	notPropagated = "not propagated"
+
+	// Exit codes follow the Nagios plugin convention (OK, WARNING, CRITICAL, UNKNOWN) so that dry runs
+	// can be used as monitoring check
+	exitOK             = 0
+	exitChangesPending = 1
+	exitError          = 2
+	exitNotPropagated  = 3
+)
+
+// hostPlan describes what a run does for a single host and address family
+type hostPlan struct {
+	Host     string   `json:"host"`
+	Family   string   `json:"family"`
+	Detected string   `json:"detected,omitempty"`
+	Current  []string `json:"current"`
+	Action   string   `json:"action"`
+	Error    string   `json:"error,omitempty"`
+	// Propagation is the outcome of the verification after an update, if enabled
+	Propagation string `json:"propagation,omitempty"`
+
+	domain string
+	// proxied records resolve to the addresses of the proxy, so their propagation can't be verified
+	proxied bool
+}
+
+// writeHostPlans prints the plan of a dry run as table or JSON
+func writeHostPlans(w io.Writer, plans []hostPlan, output string) error {
+	if output == "json" {
+		return writeJSON(w, plans)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tFAMILY\tDETECTED\tCURRENT\tACTION\tERROR")
+	for _, plan := range plans {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", plan.Host, plan.Family, orDash(plan.Detected),
+			orDash(strings.Join(plan.Current, ",")), plan.Action, orDash(plan.Error))
+	}
+	return tw.Flush()
+}
+
+// exitCode maps the outcome of a run to the exit code: exitError if anything went wrong,
+// exitChangesPending if a dry run found records that need updating, exitNotPropagated if an
+// update wasn't served by all nameservers in time and exitOK otherwise
+func exitCode(plans []hostPlan, err error, dryRun bool) int {
+	if err != nil {
+		return exitError
+	}
+
+	pending := false
+	notServed := false
+	for _, plan := range plans {
+		if plan.Error != "" {
+			return exitError
+		}
+		if plan.Action == actionUpdate {
+			pending = true
+		}
+		if plan.Propagation == notPropagated {
+			notServed = true
+		}
+	}
+
+	if dryRun && pending {
+		return exitChangesPending
+	}
+	if notServed {
+		return exitNotPropagated
+	}
+	return exitOK
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		plans    []hostPlan
+		err      error
+		dryRun   bool
+		expected int
+	}{
+		{"nothing to do", []hostPlan{{Action: actionNone}}, nil, false, exitOK},
+		{"updated", []hostPlan{{Action: actionUpdate}}, nil, false, exitOK},
+		{"missing family", []hostPlan{{Action: actionNone}, {Action: actionSkip}}, nil, false, exitOK},
+		{"changes pending", []hostPlan{{Action: actionNone}, {Action: actionUpdate}}, nil, true, exitChangesPending},
+		{"failed update", []hostPlan{{Action: actionUpdate, Error: "refused"}}, nil, false, exitError},
+		{"failed dry run", []hostPlan{{Action: actionUpdate}, {Action: actionSkip, Error: "lookup failed"}}, nil, true, exitError},
+		{"error", []hostPlan{}, errors.New("failed"), false, exitError},
+		{"not propagated", []hostPlan{{Action: actionUpdate, Propagation: notPropagated}}, nil, false, exitNotPropagated},
+		{"propagated", []hostPlan{{Action: actionUpdate, Propagation: propagated}}, nil, false, exitOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if code := exitCode(test.plans, test.err, test.dryRun); code != test.expected {
+				t.Errorf("got exit code %d, want %d", code, test.expected)
+			}
+		})
+	}
+}
+
+func TestNoPublicAddressFails(t *testing.T) {
+	job := hostJob{
+		domain:  &DomainConfig{DomainName: "example.com"},
+		updates: &providerUpdates{},
+		host:    HostConfig{Name: "home"},
+	}
+
+	for _, config := range []*Config{{}, {DisableV6: true}} {
+		plans, err := processHost(zap.NewNop(), config, job, nil, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plans) == 0 {
+			t.Fatal("expected the enabled families to be planned")
+		}
+		for _, plan := range plans {
+			if plan.Action != actionSkip || plan.Error == "" {
+				t.Errorf("expected the %s family to be skipped with an error, got %+v", plan.Family, plan)
+			}
+		}
+		if code := exitCode(plans, err, false); code != exitError {
+			t.Errorf("got exit code %d, want %d", code, exitError)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package rfc2136
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dschanoeh/hover-ddns/dnsprovider"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultTSIGAlgorithm = dns.HmacSHA256
+	tsigFudge            = 300
+	timeout              = 10 * time.Second
+)
+
+// Client updates the records of zones with RFC 2136 dynamic updates. If a TSIG key is given,
+// all messages are signed with it.
+type Client struct {
+	logger    *zap.SugaredLogger
+	server    string
+	keyName   string
+	secret    string
+	algorithm string
+}
+
+// NewClient creates a client for the given server. The secret is expected in base64 encoding
+// like in BIND key files.
+func NewClient(logger *zap.Logger, server string, keyName string, secret string, algorithm string) (*Client, error) {
+	if server == "" {
+		return nil, errors.New("a server must be provided")
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	if (keyName == "") != (secret == "") {
+		return nil, errors.New("TSIG key name and secret must be provided together")
+	}
+	if _, err := base64.StdEncoding.DecodeString(secret); err != nil {
+		return nil, errors.New("the TSIG secret is not valid base64")
+	}
+
+	if algorithm == "" {
+		algorithm = DefaultTSIGAlgorithm
+	}
+	algorithm = dns.Fqdn(strings.ToLower(algorithm))
+	switch algorithm {
+	case dns.HmacSHA1, dns.HmacSHA224, dns.HmacSHA256, dns.HmacSHA384, dns.HmacSHA512:
+	default:
+		return nil, errors.New("'" + algorithm + "' is not a supported TSIG algorithm")
+	}
+
+	client := Client{
+		logger:    logger.Sugar(),
+		server:    server,
+		secret:    secret,
+		algorithm: algorithm,
+	}
+	if keyName != "" {
+		client.keyName = dns.Fqdn(strings.ToLower(keyName))
+	}
+
+	return &client, nil
+}
+
+// WithLogger returns a copy of the client that logs to logger
+func (c *Client) WithLogger(logger *zap.Logger) dnsprovider.Provider {
+	client := *c
+	client.logger = logger.Sugar()
+	return &client
+}
+
+// Authenticate does nothing as every message is signed on its own
+func (c *Client) Authenticate() error {
+	return nil
+}
+
+// Records transfers the zone with AXFR. The server has to allow transfers to this host or key.
+func (c *Client) Records(domain string) ([]dnsprovider.Record, error) {
+	zone := dns.Fqdn(strings.ToLower(domain))
+	message := dns.Msg{}
+	message.SetAxfr(zone)
+	c.sign(&message)
+
+	transfer := dns.Transfer{DialTimeout: timeout, ReadTimeout: timeout}
+	if c.signed() {
+		transfer.TsigSecret = map[string]string{c.keyName: c.secret}
+	}
+	envelopes, err := transfer.In(&message, c.server)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []dnsprovider.Record{}
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, envelope.Error
+		}
+		for _, rr := range envelope.RR {
+			if rr.Header().Rrtype == dns.TypeSOA {
+				continue
+			}
+			records = append(records, toRecord(zone, rr))
+		}
+	}
+
+	return records, nil
+}
+
+// UpsertRecord replaces the RRset of the given name and type with a single record in one update message
+func (c *Client) UpsertRecord(domain string, name string, recordType string, content string, ttl int) error {
+	zone := dns.Fqdn(strings.ToLower(domain))
+	fqdn := recordName(name, zone)
+	rr, err := newRR(fqdn, ttl, recordType, content)
+	if err != nil {
+		return err
+	}
+
+	message := dns.Msg{}
+	message.SetUpdate(zone)
+	message.RemoveRRset([]dns.RR{rrset(fqdn, rr.Header().Rrtype)})
+	message.Insert([]dns.RR{rr})
+
+	c.logger.Infof("Replacing %s records of %s with '%s'...", recordType, fqdn, content)
+	return c.exchange(&message)
+}
+
+// AddRecord adds a record to the RRset of the given name and type
+func (c *Client) AddRecord(domain string, name string, recordType string, content string, ttl int) error {
+	zone := dns.Fqdn(strings.ToLower(domain))
+	fqdn := recordName(name, zone)
+	rr, err := newRR(fqdn, ttl, recordType, content)
+	if err != nil {
+		return err
+	}
+
+	message := dns.Msg{}
+	message.SetUpdate(zone)
+	message.Insert([]dns.RR{rr})
+
+	c.logger.Infof("Adding %s record '%s' to %s...", recordType, content, fqdn)
+	return c.exchange(&message)
+}
+
+// DeleteRecords removes the RRset of the given name and type
+func (c *Client) DeleteRecords(domain string, name string, recordType string) error {
+	zone := dns.Fqdn(strings.ToLower(domain))
+	fqdn := recordName(name, zone)
+	dnsType, ok := dns.StringToType[strings.ToUpper(recordType)]
+	if !ok {
+		return errors.New("'" + recordType + "' is not a valid record type")
+	}
+
+	message := dns.Msg{}
+	message.SetUpdate(zone)
+	message.RemoveRRset([]dns.RR{rrset(fqdn, dnsType)})
+
+	c.logger.Infof("Deleting %s records of %s...", recordType, fqdn)
+	return c.exchange(&message)
+}
+
+// DeleteRecord removes the record with the given content from the RRset of the given name and type
+func (c *Client) DeleteRecord(domain string, name string, recordType string, content string) error {
+	zone := dns.Fqdn(strings.ToLower(domain))
+	fqdn := recordName(name, zone)
+	rr, err := newRR(fqdn, 0, recordType, content)
+	if err != nil {
+		return err
+	}
+
+	message := dns.Msg{}
+	message.SetUpdate(zone)
+	message.Remove([]dns.RR{rr})
+
+	c.logger.Infof("Deleting %s record '%s' of %s...", recordType, content, fqdn)
+	return c.exchange(&message)
+}
+
+func (c *Client) exchange(message *dns.Msg) error {
+	c.sign(message)
+
+	client := dns.Client{Net: "tcp", Timeout: timeout}
+	if c.signed() {
+		client.TsigSecret = map[string]string{c.keyName: c.secret}
+	}
+
+	res, _, err := client.Exchange(message, c.server)
+	if err != nil {
+		return err
+	}
+	if res.Rcode != dns.RcodeSuccess {
+		return errors.New("update refused with " + dns.RcodeToString[res.Rcode])
+	}
+
+	return nil
+}
+
+func (c *Client) sign(message *dns.Msg) {
+	if c.signed() {
+		message.SetTsig(c.keyName, c.algorithm, tsigFudge, time.Now().Unix())
+	}
+}
+
+func (c *Client) signed() bool {
+	return c.keyName != ""
+}
+
+// recordName returns the absolute name of a record relative to zone
+func recordName(name string, zone string) string {
+	if name == "@" || name == "" {
+		return zone
+	}
+	return dns.Fqdn(strings.ToLower(name) + "." + zone)
+}
+
+// newRR parses a record given in presentation format. TXT content is quoted if necessary.
+func newRR(fqdn string, ttl int, recordType string, content string) (dns.RR, error) {
+	if strings.EqualFold(recordType, "TXT") && !strings.HasPrefix(content, `"`) {
+		content = strconv.Quote(content)
+	}
+	return dns.NewRR(fmt.Sprintf("%s %d IN %s %s", fqdn, ttl, recordType, content))
+}
+
+// rrset returns the placeholder record used to address a whole RRset in update messages
+func rrset(fqdn string, dnsType uint16) dns.RR {
+	return &dns.ANY{Hdr: dns.RR_Header{Name: fqdn, Rrtype: dnsType, Class: dns.ClassINET}}
+}
+
+// toRecord converts a transferred record to the relative form used by the providers
+func toRecord(zone string, rr dns.RR) dnsprovider.Record {
+	header := rr.Header()
+	name := strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(header.Name), zone), ".")
+	if name == "" {
+		name = "@"
+	}
+
+	record := dnsprovider.Record{
+		Name: name,
+		Type: dns.TypeToString[header.Rrtype],
+		TTL:  int(header.Ttl),
+	}
+	switch r := rr.(type) {
+	case *dns.TXT:
+		record.Content = strings.Join(r.Txt, "")
+	default:
+		record.Content = strings.TrimPrefix(rr.String(), header.String())
+	}
+
+	return record
+}
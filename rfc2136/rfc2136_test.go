@@ -0,0 +1,256 @@
+package rfc2136
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+const (
+	testZone    = "example.com."
+	testKeyName = "hover-ddns."
+	testSecret  = "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0"
+)
+
+// testServer is an authoritative server for testZone that applies dynamic updates to an in-memory zone
+// and serves it with AXFR. Unsigned or badly signed messages are answered with NOTAUTH, updates
+// are refused with rcode if it is set.
+type testServer struct {
+	mutex   sync.Mutex
+	records []dns.RR
+	rcode   int
+	updates int
+}
+
+func (s *testServer) ServeDNS(w dns.ResponseWriter, request *dns.Msg) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	reply := &dns.Msg{}
+	reply.SetReply(request)
+	if tsig := request.IsTsig(); tsig != nil {
+		reply.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, int64(tsig.TimeSigned))
+	}
+
+	switch {
+	case request.IsTsig() == nil || w.TsigStatus() != nil:
+		reply.Rcode = dns.RcodeNotAuth
+	case request.Opcode == dns.OpcodeUpdate:
+		s.updates++
+		if s.rcode != dns.RcodeSuccess {
+			reply.Rcode = s.rcode
+		} else {
+			s.apply(request.Ns)
+		}
+	case len(request.Question) == 1 && request.Question[0].Qtype == dns.TypeAXFR:
+		soa, _ := dns.NewRR(testZone + " 3600 IN SOA ns.example.com. hostmaster.example.com. 1 3600 600 86400 300")
+		reply.Answer = append(append([]dns.RR{soa}, s.records...), soa)
+	default:
+		reply.Rcode = dns.RcodeRefused
+	}
+
+	w.WriteMsg(reply)
+}
+
+// apply carries out the update section of a message as described in RFC 2136 section 3.4.2
+func (s *testServer) apply(updates []dns.RR) {
+	for _, update := range updates {
+		header := update.Header()
+		switch header.Class {
+		case dns.ClassANY:
+			s.remove(func(rr dns.RR) bool {
+				return strings.EqualFold(rr.Header().Name, header.Name) && rr.Header().Rrtype == header.Rrtype
+			})
+		case dns.ClassNONE:
+			s.remove(func(rr dns.RR) bool {
+				return sameRecord(rr, update)
+			})
+		default:
+			s.remove(func(rr dns.RR) bool {
+				return sameRecord(rr, update)
+			})
+			s.records = append(s.records, update)
+		}
+	}
+}
+
+func (s *testServer) remove(match func(rr dns.RR) bool) {
+	kept := []dns.RR{}
+	for _, rr := range s.records {
+		if !match(rr) {
+			kept = append(kept, rr)
+		}
+	}
+	s.records = kept
+}
+
+// sameRecord compares records ignoring TTL and class
+func sameRecord(a dns.RR, b dns.RR) bool {
+	a, b = dns.Copy(a), dns.Copy(b)
+	a.Header().Ttl, b.Header().Ttl = 0, 0
+	a.Header().Class, b.Header().Class = dns.ClassINET, dns.ClassINET
+	return strings.EqualFold(a.String(), b.String())
+}
+
+// zone returns the records of the zone in presentation format without TTL, sorted
+func (s *testServer) zone() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := []string{}
+	for _, rr := range s.records {
+		rr = dns.Copy(rr)
+		rr.Header().Ttl = 0
+		result = append(result, rr.String())
+	}
+	sort.Strings(result)
+	return result
+}
+
+func startTestServer(t *testing.T, records ...string) (*testServer, string) {
+	t.Helper()
+	handler := &testServer{}
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler.records = append(handler.records, rr)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{
+		Listener:          listener,
+		Handler:           handler,
+		TsigSecret:        map[string]string{testKeyName: testSecret},
+		NotifyStartedFunc: func() { close(started) },
+		MsgAcceptFunc: func(dh dns.Header) dns.MsgAcceptAction {
+			return dns.MsgAccept
+		},
+	}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+
+	return handler, listener.Addr().String()
+}
+
+func newTestClient(t *testing.T, server string, secret string) *Client {
+	t.Helper()
+	client, err := NewClient(zap.NewNop(), server, testKeyName, secret, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func expectZone(t *testing.T, handler *testServer, expected ...string) {
+	t.Helper()
+	zone := handler.zone()
+	sort.Strings(expected)
+	if strings.Join(zone, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got zone\n%s\nwant\n%s", strings.Join(zone, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestUpsertRecordReplacesRRset(t *testing.T) {
+	handler, server := startTestServer(t,
+		"home.example.com. 300 IN A 198.51.100.1",
+		"home.example.com. 300 IN A 198.51.100.2",
+		"home.example.com. 300 IN AAAA 2001:db8::1",
+	)
+	client := newTestClient(t, server, testSecret)
+
+	err := client.UpsertRecord("example.com", "home", "A", "198.51.100.3", 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZone(t, handler,
+		"home.example.com.\t0\tIN\tA\t198.51.100.3",
+		"home.example.com.\t0\tIN\tAAAA\t2001:db8::1",
+	)
+}
+
+func TestAddAndDeleteRecord(t *testing.T) {
+	handler, server := startTestServer(t, "_acme-challenge.example.com. 300 IN TXT \"old\"")
+	client := newTestClient(t, server, testSecret)
+
+	err := client.AddRecord("example.com", "_acme-challenge", "TXT", "new token", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZone(t, handler,
+		"_acme-challenge.example.com.\t0\tIN\tTXT\t\"new token\"",
+		"_acme-challenge.example.com.\t0\tIN\tTXT\t\"old\"",
+	)
+
+	err = client.DeleteRecord("example.com", "_acme-challenge", "TXT", "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZone(t, handler, "_acme-challenge.example.com.\t0\tIN\tTXT\t\"new token\"")
+
+	err = client.DeleteRecords("example.com", "_acme-challenge", "TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZone(t, handler)
+}
+
+func TestRecords(t *testing.T) {
+	_, server := startTestServer(t,
+		"example.com. 300 IN MX 10 mx.example.net.",
+		"www.example.com. 900 IN CNAME example.com.",
+		"example.com. 300 IN TXT \"v=spf1 -all\"",
+	)
+	client := newTestClient(t, server, testSecret)
+
+	records, err := client.Records("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, record := range records {
+		got = append(got, record.Name+" "+record.Type+" "+record.Content)
+	}
+	expected := []string{"@ MX 10 mx.example.net.", "www CNAME example.com.", "@ TXT v=spf1 -all"}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got records\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestUpdateRefused(t *testing.T) {
+	handler, server := startTestServer(t, "home.example.com. 300 IN A 198.51.100.1")
+	handler.rcode = dns.RcodeRefused
+	client := newTestClient(t, server, testSecret)
+
+	err := client.UpsertRecord("example.com", "home", "A", "198.51.100.3", 300)
+	if err == nil || !strings.Contains(err.Error(), "REFUSED") {
+		t.Errorf("expected the update to be refused, got %v", err)
+	}
+	expectZone(t, handler, "home.example.com.\t0\tIN\tA\t198.51.100.1")
+}
+
+func TestUpdateWithWrongKey(t *testing.T) {
+	handler, server := startTestServer(t, "home.example.com. 300 IN A 198.51.100.1")
+	client := newTestClient(t, server, "b3RoZXItc2VjcmV0")
+
+	err := client.UpsertRecord("example.com", "home", "A", "198.51.100.3", 300)
+	if err == nil {
+		t.Error("expected the update signed with the wrong key to fail")
+	}
+	if handler.updates != 0 {
+		t.Errorf("%d unauthenticated updates were applied", handler.updates)
+	}
+	expectZone(t, handler, "home.example.com.\t0\tIN\tA\t198.51.100.1")
+}
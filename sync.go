@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dschanoeh/hover-ddns/dnsprovider"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	changeCreate = "create"
+	changeUpdate = "update"
+	changeDelete = "delete"
+)
+
+// ZoneConfig describes the desired records of a domain for the plan and apply commands
+type ZoneConfig struct {
+	Records []ZoneRecordConfig `yaml:"records"`
+}
+
+type ZoneRecordConfig struct {
+	Name    string `yaml:"name"`
+	Type    string `yaml:"type"`
+	Content string `yaml:"content"`
+	TTL     int    `yaml:"ttl"`
+}
+
+// recordChange is a single action needed to get from the live records to the desired ones
+type recordChange struct {
+	Action string              `json:"action"`
+	Name   string              `json:"name"`
+	Type   string              `json:"type"`
+	Old    *dnsprovider.Record `json:"old,omitempty"`
+	New    *dnsprovider.Record `json:"new,omitempty"`
+}
+
+// syncRecords implements the plan and apply commands. Only names and types that appear in the desired
+// records are touched unless prune is set.
+func syncRecords(logger *zap.Logger, config *Config, args []string, output string, apply bool) error {
+	command := "plan"
+	if apply {
+		command = "apply"
+	}
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	prune := flags.Bool("prune", false, "delete records of names and types that are not in the file")
+	autoApprove := flags.Bool("auto-approve", false, "apply without asking for confirmation")
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return errors.New("usage: " + command + " <domain> <file> [--prune] [--auto-approve]")
+	}
+	domain := strings.ToLower(strings.TrimSuffix(positional[0], "."))
+
+	backend, domainConfig, err := commandProvider(logger, config, domain)
+	if err != nil {
+		return err
+	}
+
+	desired, err := loadDesiredRecords(positional[1], domain, recordTTL(&domainConfig.Provider))
+	if err != nil {
+		return err
+	}
+
+	live, err := backend.Records(domain)
+	if err != nil {
+		return err
+	}
+
+	changes := planChanges(domain, live, desired, *prune)
+	if output == "json" {
+		err = writeJSON(os.Stdout, changes)
+	} else {
+		err = writePlan(os.Stdout, changes)
+	}
+	if err != nil || !apply || len(changes) == 0 {
+		return err
+	}
+
+	if !*autoApprove {
+		approved, err := confirm(os.Stdin, os.Stderr)
+		if err != nil {
+			return err
+		}
+		if !approved {
+			return errors.New("apply cancelled")
+		}
+	}
+
+	return applyChanges(backend, domain, changes)
+}
+
+// loadDesiredRecords reads the desired records of domain from a YAML file (.yaml or .yml) or a zone file.
+// Records of YAML files without TTL get defaultTTL.
+func loadDesiredRecords(filename string, domain string, defaultTTL int) ([]dnsprovider.Record, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := []dnsprovider.Record{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		zoneConfig := ZoneConfig{}
+		err = yaml.NewDecoder(file).Decode(&zoneConfig)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range zoneConfig.Records {
+			record := dnsprovider.Record{Name: r.Name, Type: strings.ToUpper(r.Type), Content: r.Content, TTL: r.TTL}
+			if record.TTL == 0 {
+				record.TTL = defaultTTL
+			}
+			records = append(records, record)
+		}
+	default:
+		parser := dns.NewZoneParser(file, dns.Fqdn(domain), filename)
+		for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+			if rr.Header().Rrtype == dns.TypeSOA {
+				continue
+			}
+			record, err := rrToRecord(domain, rr)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+		if err = parser.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, record := range records {
+		if err = validateHostName(record.Name, domain); err != nil {
+			return nil, err
+		}
+		if _, err = recordToRR(domain, record); err != nil {
+			return nil, errors.New("invalid record " + record.Name + " " + record.Type + ": " + err.Error())
+		}
+	}
+
+	return records, nil
+}
+
+// rrToRecord converts a resource record of the given zone into the form the providers use
+func rrToRecord(domain string, rr dns.RR) (dnsprovider.Record, error) {
+	header := rr.Header()
+	origin := dns.Fqdn(domain)
+	name := strings.ToLower(header.Name)
+	if name != origin && !strings.HasSuffix(name, "."+origin) {
+		return dnsprovider.Record{}, errors.New("'" + header.Name + "' is not part of the domain '" + domain + "'")
+	}
+
+	record := dnsprovider.Record{
+		Name: normalizeRecordName(strings.TrimSuffix(strings.TrimSuffix(name, origin), ".")),
+		Type: dns.TypeToString[header.Rrtype],
+		TTL:  int(header.Ttl),
+	}
+
+	switch r := rr.(type) {
+	case *dns.TXT:
+		record.Content = strings.Join(r.Txt, "")
+	default:
+		// Providers expect host names without the trailing dot
+		fields := strings.Fields(strings.TrimPrefix(rr.String(), header.String()))
+		for i := range fields {
+			fields[i] = strings.TrimSuffix(fields[i], ".")
+		}
+		record.Content = strings.Join(fields, " ")
+	}
+
+	return record, nil
+}
+
+// planChanges compares the live records of a domain with the desired ones. Records are compared by their
+// parsed data so that different spellings of the same content don't cause changes.
+func planChanges(domain string, live []dnsprovider.Record, desired []dnsprovider.Record, prune bool) []recordChange {
+	liveGroups := groupRecords(domain, live)
+	desiredGroups := groupRecords(domain, desired)
+
+	keys := []string{}
+	for key := range desiredGroups {
+		keys = append(keys, key)
+	}
+	if prune {
+		for key := range liveGroups {
+			if _, ok := desiredGroups[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	changes := []recordChange{}
+	for _, key := range keys {
+		current := liveGroups[key]
+		wanted := desiredGroups[key]
+
+		var unmatchedWanted []keyedRecord
+		for _, w := range wanted {
+			found := false
+			for i, c := range current {
+				if c.data == w.data {
+					if c.record.TTL != w.record.TTL {
+						oldRecord, newRecord := c.record, w.record
+						changes = append(changes, newRecordChange(changeUpdate, &oldRecord, &newRecord))
+					}
+					current = append(current[:i:i], current[i+1:]...)
+					found = true
+					break
+				}
+			}
+			if !found {
+				unmatchedWanted = append(unmatchedWanted, w)
+			}
+		}
+		unmatchedCurrent := current
+
+		// Records that changed their content are shown as updates, the rest as creates and deletes
+		for len(unmatchedCurrent) > 0 && len(unmatchedWanted) > 0 {
+			changes = append(changes, newRecordChange(changeUpdate, &unmatchedCurrent[0].record, &unmatchedWanted[0].record))
+			unmatchedCurrent, unmatchedWanted = unmatchedCurrent[1:], unmatchedWanted[1:]
+		}
+		for i := range unmatchedWanted {
+			changes = append(changes, newRecordChange(changeCreate, nil, &unmatchedWanted[i].record))
+		}
+		for i := range unmatchedCurrent {
+			changes = append(changes, newRecordChange(changeDelete, &unmatchedCurrent[i].record, nil))
+		}
+	}
+
+	return changes
+}
+
+type keyedRecord struct {
+	record dnsprovider.Record
+	data   string
+}
+
+// groupRecords groups records by name and type. The records of each group are sorted by their data.
+// Records that can't be parsed are compared by their content.
+func groupRecords(domain string, records []dnsprovider.Record) map[string][]keyedRecord {
+	groups := map[string][]keyedRecord{}
+	for _, record := range records {
+		data := recordData(domain, record)
+		key := strings.ToLower(recordFQDN(normalizeRecordName(record.Name), domain)) + " " + strings.ToUpper(record.Type)
+		groups[key] = append(groups[key], keyedRecord{record: record, data: data})
+	}
+
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].data < group[j].data
+		})
+	}
+
+	return groups
+}
+
+// recordData returns the data of a record in a form that is equal for different spellings of the same content
+func recordData(domain string, record dnsprovider.Record) string {
+	data := record.Content
+	rr, err := recordToRR(domain, record)
+	if err == nil {
+		data = strings.TrimPrefix(rr.String(), rr.Header().String())
+	}
+	if !strings.EqualFold(record.Type, "TXT") {
+		data = strings.ToLower(data)
+	}
+	return data
+}
+
+func newRecordChange(action string, oldRecord *dnsprovider.Record, newRecord *dnsprovider.Record) recordChange {
+	change := recordChange{Action: action, Old: oldRecord, New: newRecord}
+	if newRecord != nil {
+		change.Name, change.Type = newRecord.Name, newRecord.Type
+	} else {
+		change.Name, change.Type = oldRecord.Name, oldRecord.Type
+	}
+	return change
+}
+
+func writePlan(w io.Writer, changes []recordChange) error {
+	counts := map[string]int{}
+	for _, change := range changes {
+		counts[change.Action]++
+		var err error
+		switch change.Action {
+		case changeCreate:
+			_, err = fmt.Fprintf(w, "+ %s %s %s (ttl %d)\n", change.Name, change.Type, change.New.Content, change.New.TTL)
+		case changeUpdate:
+			_, err = fmt.Fprintf(w, "~ %s %s %s -> %s (ttl %d -> %d)\n", change.Name, change.Type,
+				change.Old.Content, change.New.Content, change.Old.TTL, change.New.TTL)
+		case changeDelete:
+			_, err = fmt.Fprintf(w, "- %s %s %s\n", change.Name, change.Type, change.Old.Content)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(w, "No changes. The records are up to date.")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "Plan: %d to create, %d to update, %d to delete.\n",
+		counts[changeCreate], counts[changeUpdate], counts[changeDelete])
+	return err
+}
+
+// confirm asks whether the plan should be applied. Only 'yes' is accepted.
+func confirm(in io.Reader, out io.Writer) (bool, error) {
+	fmt.Fprint(out, "Do you want to apply these changes? Only 'yes' will be accepted: ")
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return strings.TrimSpace(answer) == "yes", nil
+}
+
+// applyChanges carries out the planned changes. Updates change the record in place if the provider supports
+// it. Otherwise the new record is added before the old one is deleted, so that a failing update doesn't lose
+// the record. Types that allow only a single record and changes of the TTL alone have to delete first.
+func applyChanges(backend dnsprovider.Provider, domain string, changes []recordChange) error {
+	for _, change := range changes {
+		var err error
+		switch {
+		case change.Old == nil:
+			err = backend.AddRecord(domain, change.New.Name, change.New.Type, change.New.Content, change.New.TTL)
+		case change.New == nil:
+			err = backend.DeleteRecord(domain, change.Old.Name, change.Old.Type, change.Old.Content)
+		default:
+			err = updateRecord(backend, domain, change)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func updateRecord(backend dnsprovider.Provider, domain string, change recordChange) error {
+	if updater, ok := backend.(dnsprovider.RecordUpdater); ok {
+		return updater.UpdateRecord(domain, change.Old.Name, change.Old.Type, change.Old.Content, change.New.Content, change.New.TTL)
+	}
+
+	if strings.EqualFold(change.Type, "CNAME") || recordData(domain, *change.Old) == recordData(domain, *change.New) {
+		err := backend.DeleteRecord(domain, change.Old.Name, change.Old.Type, change.Old.Content)
+		if err != nil {
+			return err
+		}
+		return backend.AddRecord(domain, change.New.Name, change.New.Type, change.New.Content, change.New.TTL)
+	}
+
+	err := backend.AddRecord(domain, change.New.Name, change.New.Type, change.New.Content, change.New.TTL)
+	if err != nil {
+		return err
+	}
+	return backend.DeleteRecord(domain, change.Old.Name, change.Old.Type, change.Old.Content)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dschanoeh/hover-ddns/dnsprovider"
+	"go.uber.org/zap"
+)
+
+func TestPlanChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		live     []dnsprovider.Record
+		desired  []dnsprovider.Record
+		prune    bool
+		expected []string
+	}{
+		{
+			name:     "up to date",
+			live:     []dnsprovider.Record{{Name: "www", Type: "CNAME", Content: "example.com", TTL: 900}},
+			desired:  []dnsprovider.Record{{Name: "www", Type: "CNAME", Content: "Example.com.", TTL: 900}},
+			expected: []string{},
+		},
+		{
+			name:     "create",
+			desired:  []dnsprovider.Record{{Name: "@", Type: "MX", Content: "10 mx.example.net", TTL: 300}},
+			expected: []string{"create @ MX -> 10 mx.example.net"},
+		},
+		{
+			name:     "changed ttl",
+			live:     []dnsprovider.Record{{Name: "www", Type: "A", Content: "198.51.100.1", TTL: 300}},
+			desired:  []dnsprovider.Record{{Name: "www", Type: "A", Content: "198.51.100.1", TTL: 900}},
+			expected: []string{"update www A 198.51.100.1 -> 198.51.100.1"},
+		},
+		{
+			name: "changed content",
+			live: []dnsprovider.Record{
+				{Name: "www", Type: "A", Content: "198.51.100.1", TTL: 300},
+				{Name: "www", Type: "A", Content: "198.51.100.2", TTL: 300},
+			},
+			desired: []dnsprovider.Record{
+				{Name: "www", Type: "A", Content: "198.51.100.2", TTL: 300},
+				{Name: "www", Type: "A", Content: "198.51.100.3", TTL: 300},
+				{Name: "www", Type: "A", Content: "198.51.100.4", TTL: 300},
+			},
+			expected: []string{"update www A 198.51.100.1 -> 198.51.100.3", "create www A -> 198.51.100.4"},
+		},
+		{
+			name:     "unmanaged records are kept",
+			live:     []dnsprovider.Record{{Name: "home", Type: "A", Content: "198.51.100.1", TTL: 300}},
+			expected: []string{},
+		},
+		{
+			name:     "prune",
+			live:     []dnsprovider.Record{{Name: "home", Type: "A", Content: "198.51.100.1", TTL: 300}},
+			prune:    true,
+			expected: []string{"delete home A 198.51.100.1 ->"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := []string{}
+			for _, change := range planChanges("example.com", test.live, test.desired, test.prune) {
+				line := change.Action + " " + change.Name + " " + change.Type
+				if change.Old != nil {
+					line += " " + change.Old.Content
+				}
+				line += " ->"
+				if change.New != nil {
+					line += " " + change.New.Content
+				}
+				got = append(got, line)
+			}
+			if strings.Join(got, "\n") != strings.Join(test.expected, "\n") {
+				t.Errorf("got changes\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.expected, "\n"))
+			}
+		})
+	}
+}
+
+// recordingProvider records the calls of the write methods and fails AddRecord if failAdd is set
+type recordingProvider struct {
+	calls   []string
+	failAdd bool
+}
+
+func (p *recordingProvider) Authenticate() error { return nil }
+
+func (p *recordingProvider) Records(domain string) ([]dnsprovider.Record, error) { return nil, nil }
+
+func (p *recordingProvider) UpsertRecord(domain string, name string, recordType string, content string, ttl int) error {
+	p.calls = append(p.calls, fmt.Sprintf("upsert %s %s %s", name, recordType, content))
+	return nil
+}
+
+func (p *recordingProvider) AddRecord(domain string, name string, recordType string, content string, ttl int) error {
+	p.calls = append(p.calls, fmt.Sprintf("add %s %s %s", name, recordType, content))
+	if p.failAdd {
+		return errors.New("add failed")
+	}
+	return nil
+}
+
+func (p *recordingProvider) DeleteRecords(domain string, name string, recordType string) error {
+	p.calls = append(p.calls, fmt.Sprintf("delete %s %s", name, recordType))
+	return nil
+}
+
+func (p *recordingProvider) DeleteRecord(domain string, name string, recordType string, content string) error {
+	p.calls = append(p.calls, fmt.Sprintf("delete %s %s %s", name, recordType, content))
+	return nil
+}
+
+func (p *recordingProvider) WithLogger(logger *zap.Logger) dnsprovider.Provider { return p }
+
+// updatingProvider additionally changes records in place
+type updatingProvider struct {
+	recordingProvider
+}
+
+func (p *updatingProvider) UpdateRecord(domain string, name string, recordType string, oldContent string, content string, ttl int) error {
+	p.calls = append(p.calls, fmt.Sprintf("update %s %s %s %s", name, recordType, oldContent, content))
+	return nil
+}
+
+func TestApplyChanges(t *testing.T) {
+	update := func(recordType string, oldContent string, oldTTL int, newContent string, newTTL int) recordChange {
+		return newRecordChange(changeUpdate,
+			&dnsprovider.Record{Name: "www", Type: recordType, Content: oldContent, TTL: oldTTL},
+			&dnsprovider.Record{Name: "www", Type: recordType, Content: newContent, TTL: newTTL})
+	}
+
+	tests := []struct {
+		name     string
+		backend  dnsprovider.Provider
+		change   recordChange
+		expected []string
+	}{
+		{
+			name:     "in place",
+			backend:  &updatingProvider{},
+			change:   update("A", "198.51.100.1", 300, "198.51.100.2", 300),
+			expected: []string{"update www A 198.51.100.1 198.51.100.2"},
+		},
+		{
+			name:     "add before delete",
+			backend:  &recordingProvider{},
+			change:   update("A", "198.51.100.1", 300, "198.51.100.2", 300),
+			expected: []string{"add www A 198.51.100.2", "delete www A 198.51.100.1"},
+		},
+		{
+			name:     "failed add keeps the old record",
+			backend:  &recordingProvider{failAdd: true},
+			change:   update("A", "198.51.100.1", 300, "198.51.100.2", 300),
+			expected: []string{"add www A 198.51.100.2"},
+		},
+		{
+			name:     "cname",
+			backend:  &recordingProvider{},
+			change:   update("CNAME", "example.com", 300, "example.net", 300),
+			expected: []string{"delete www CNAME example.com", "add www CNAME example.net"},
+		},
+		{
+			name:     "ttl only",
+			backend:  &recordingProvider{},
+			change:   update("A", "198.51.100.1", 300, "198.51.100.1", 900),
+			expected: []string{"delete www A 198.51.100.1", "add www A 198.51.100.1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			applyChanges(test.backend, "example.com", []recordChange{test.change})
+
+			var calls []string
+			switch backend := test.backend.(type) {
+			case *recordingProvider:
+				calls = backend.calls
+			case *updatingProvider:
+				calls = backend.calls
+			}
+			if strings.Join(calls, "\n") != strings.Join(test.expected, "\n") {
+				t.Errorf("got calls\n%s\nwant\n%s", strings.Join(calls, "\n"), strings.Join(test.expected, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dschanoeh/hover-ddns/dnsprovider"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+func exportZone(logger *zap.Logger, config *Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: export <domain>")
+	}
+	domain := strings.ToLower(strings.TrimSuffix(args[0], "."))
+
+	backend, _, err := commandProvider(logger, config, domain)
+	if err != nil {
+		return err
+	}
+	records, err := backend.Records(domain)
+	if err != nil {
+		return err
+	}
+
+	return writeZone(os.Stdout, domain, records)
+}
+
+// writeZone writes records as RFC 1035 zone file. Records are sorted by name, type and content so
+// that exports of an unchanged zone are identical. Nothing is written if any of the records can't be
+// converted, as an incomplete export is useless as backup.
+func writeZone(w io.Writer, domain string, records []dnsprovider.Record) error {
+	rrs := []dns.RR{}
+	for _, record := range records {
+		rr, err := recordToRR(domain, record)
+		if err != nil {
+			return errors.New("could not convert record " + record.Name + " " + record.Type + " '" + record.Content + "': " + err.Error())
+		}
+		rrs = append(rrs, rr)
+	}
+
+	sort.SliceStable(rrs, func(i, j int) bool {
+		a, b := rrs[i].Header(), rrs[j].Header()
+		if a.Name != b.Name {
+			return dns.CanonicalName(a.Name) < dns.CanonicalName(b.Name)
+		}
+		if a.Rrtype != b.Rrtype {
+			return dns.TypeToString[a.Rrtype] < dns.TypeToString[b.Rrtype]
+		}
+		return rrs[i].String() < rrs[j].String()
+	})
+
+	_, err := fmt.Fprintf(w, "; Zone %s exported by hover-ddns\n$ORIGIN %s\n", domain, dns.Fqdn(domain))
+	if err != nil {
+		return err
+	}
+	for _, rr := range rrs {
+		_, err = fmt.Fprintln(w, rr.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordToRR converts a record into a resource record of the given zone
+func recordToRR(domain string, record dnsprovider.Record) (dns.RR, error) {
+	content := strings.TrimSpace(record.Content)
+	if strings.EqualFold(record.Type, "TXT") && !strings.HasPrefix(content, `"`) {
+		content = strconv.Quote(content)
+	}
+
+	name := dns.Fqdn(recordFQDN(normalizeRecordName(record.Name), domain))
+	return dns.NewRR(fmt.Sprintf("%s %d IN %s %s", name, record.TTL, strings.ToUpper(record.Type), content))
+}
+
+// normalizeRecordName maps an empty record name to '@'
+func normalizeRecordName(name string) string {
+	if name == "" {
+		return "@"
+	}
+	return name
+}